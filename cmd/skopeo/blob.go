@@ -0,0 +1,407 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/image/docker"
+	"github.com/containers/image/pkg/blobinfocache"
+	"github.com/containers/image/transports"
+	"github.com/containers/image/transports/alltransports"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+func blobCmd(global *globalOptions) cli.Command {
+	return cli.Command{
+		Name:  "blob",
+		Usage: "Read, write, or check individual blobs",
+		Subcommands: []cli.Command{
+			blobGetCmd(global),
+			blobPutCmd(global),
+			blobExistsCmd(global),
+			blobMountCmd(global),
+		},
+	}
+}
+
+// blobOutput is the output format of (skopeo blob get -o), (skopeo blob put) and (skopeo blob mount).
+type blobOutput struct {
+	Digest digest.Digest
+	Size   int64
+	Path   string `json:",omitempty"` // Only for (skopeo blob get -o)
+}
+
+// blobExistsOutput is the output format of (skopeo blob exists).
+type blobExistsOutput struct {
+	Digest digest.Digest
+	Exists bool
+	Size   int64 // -1 if the blob does not exist or the size is unknown
+}
+
+// writeBlobJSON writes data as JSON to stdout.
+func writeBlobJSON(stdout io.Writer, data interface{}) error {
+	out, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, string(out))
+	return nil
+}
+
+// parseDockerRepository parses name, which must be a docker:// reference, for (skopeo blob exists) and (skopeo blob mount).
+func parseDockerRepository(name string) (types.ImageReference, error) {
+	ref, err := alltransports.ParseImageName(name)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid image name %s: %v", name, err)
+	}
+	if ref.Transport().Name() != docker.Transport.Name() {
+		return nil, fmt.Errorf("Only %s:// repositories are supported, not %s", docker.Transport.Name(), name)
+	}
+	return ref, nil
+}
+
+type blobGetOptions struct {
+	global *globalOptions
+	image  *imageOptions
+	output string // Write the blob to this file instead of standard output
+}
+
+func blobGetCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageFlags(global, sharedOpts, "", "")
+	opts := blobGetOptions{
+		global: global,
+		image:  imageOpts,
+	}
+	return cli.Command{
+		Name:  "get",
+		Usage: "Read the blob with DIGEST from the repository of IMAGE-NAME",
+		Description: `
+	Read the blob with "DIGEST" from the repository of "IMAGE-NAME", verifying its digest and size
+
+	The blob is written to standard output, or with --output, to a file; in that case, the
+	digest and size of the blob are written to standard output in JSON format
+
+	See skopeo(1) section "IMAGE NAMES" for the expected format
+	`,
+		ArgsUsage: "IMAGE-NAME DIGEST",
+		Action:    commandAction(opts.run),
+		Flags: append(append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "output, o",
+				Usage:       "write the blob to `FILE`",
+				Destination: &opts.output,
+			},
+		}, sharedFlags...), imageFlags...),
+	}
+}
+
+func (opts *blobGetOptions) run(args []string, stdout io.Writer) (retErr error) {
+	if len(args) != 2 {
+		return errors.New("Usage: skopeo blob get IMAGE-NAME DIGEST [-o FILE]")
+	}
+	imageName := args[0]
+	blobDigest, err := digest.Parse(args[1])
+	if err != nil {
+		return fmt.Errorf("Invalid digest %s: %v", args[1], err)
+	}
+
+	if err := reexecIfNecessaryForImages(imageName); err != nil {
+		return err
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+	src, err := parseImageSource(ctx, opts.image, imageName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		}
+	}()
+
+	blob, expectedSize, err := src.GetBlob(ctx, types.BlobInfo{Digest: blobDigest, Size: -1}, blobinfocache.DefaultCache(sys))
+	if err != nil {
+		return fmt.Errorf("Error reading blob %s: %v", blobDigest, err)
+	}
+	defer blob.Close()
+
+	dest := stdout
+	var tmpFile *os.File
+	if opts.output != "" {
+		// Write to a temporary file first, so that opts.output only ever contains a verified blob.
+		tmpFile, err = ioutil.TempFile(filepath.Dir(opts.output), ".skopeo-blob-")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if tmpFile != nil {
+				tmpFile.Close()
+				os.Remove(tmpFile.Name())
+			}
+		}()
+		dest = tmpFile
+	}
+
+	verifier := blobDigest.Verifier()
+	size, err := io.Copy(io.MultiWriter(dest, verifier), blob)
+	if err != nil {
+		return fmt.Errorf("Error reading blob %s: %v", blobDigest, err)
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("Blob %s does not match its digest", blobDigest)
+	}
+	if expectedSize != -1 && size != expectedSize {
+		return fmt.Errorf("Blob %s has size %d, expected %d", blobDigest, size, expectedSize)
+	}
+
+	if tmpFile == nil {
+		return nil
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile.Name(), opts.output); err != nil {
+		return err
+	}
+	tmpFile = nil
+	return writeBlobJSON(stdout, blobOutput{Digest: blobDigest, Size: size, Path: opts.output})
+}
+
+type blobPutOptions struct {
+	global *globalOptions
+	image  *imageDestOptions
+	digest string // Expected digest of the file
+}
+
+func blobPutCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageDestFlags(global, sharedOpts, "", "")
+	opts := blobPutOptions{
+		global: global,
+		image:  imageOpts,
+	}
+	return cli.Command{
+		Name:  "put",
+		Usage: "Write the contents of FILE as a blob to the repository of IMAGE-NAME",
+		Description: `
+	Write the contents of "FILE" as a blob to the repository of "IMAGE-NAME", a docker:// reference,
+	and write the digest and size of the blob to standard output in JSON format
+	`,
+		ArgsUsage: "IMAGE-NAME FILE",
+		Action:    commandAction(opts.run),
+		Flags: append(append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "digest",
+				Usage:       "fail if the contents of FILE do not match `DIGEST`",
+				Destination: &opts.digest,
+			},
+		}, sharedFlags...), imageFlags...),
+	}
+}
+
+func (opts *blobPutOptions) run(args []string, stdout io.Writer) (retErr error) {
+	if len(args) != 2 {
+		return errors.New("Usage: skopeo blob put IMAGE-NAME FILE")
+	}
+	imageName, path := args[0], args[1]
+	var expectedDigest digest.Digest
+	if opts.digest != "" {
+		d, err := digest.Parse(opts.digest)
+		if err != nil {
+			return fmt.Errorf("Invalid digest %s: %v", opts.digest, err)
+		}
+		expectedDigest = d
+	}
+
+	// Other transports may discard or replace the existing image when creating an ImageDestination
+	// (e.g. dir: deletes the contents of the directory), so writing a single blob is only safe for registries.
+	ref, err := parseDockerRepository(imageName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// The blob is always stored using digest.Canonical; expectedDigest may use a different algorithm.
+	digester := digest.Canonical.Digester()
+	writer := io.Writer(digester.Hash())
+	var verifier digest.Verifier
+	if expectedDigest != "" {
+		verifier = expectedDigest.Verifier()
+		writer = io.MultiWriter(writer, verifier)
+	}
+	size, err := io.Copy(writer, file)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %v", path, err)
+	}
+	blobDigest := digester.Digest()
+	if verifier != nil && !verifier.Verified() {
+		return fmt.Errorf("%s does not match digest %s", path, expectedDigest)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+	dest, err := ref.NewImageDestination(ctx, sys)
+	if err != nil {
+		return fmt.Errorf("Error initializing %s: %v", transports.ImageName(ref), err)
+	}
+	defer func() {
+		if err := dest.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		}
+	}()
+
+	info, err := dest.PutBlob(ctx, file, types.BlobInfo{Digest: blobDigest, Size: size}, blobinfocache.DefaultCache(sys), false)
+	if err != nil {
+		return fmt.Errorf("Error writing blob %s: %v", blobDigest, err)
+	}
+	if info.Digest != blobDigest {
+		return fmt.Errorf("Blob %s was stored with digest %s", blobDigest, info.Digest)
+	}
+	if info.Size != -1 && info.Size != size {
+		return fmt.Errorf("Blob %s was stored with size %d, expected %d", blobDigest, info.Size, size)
+	}
+	return writeBlobJSON(stdout, blobOutput{Digest: blobDigest, Size: size})
+}
+
+type blobExistsOptions struct {
+	global *globalOptions
+	image  *imageOptions
+}
+
+func blobExistsCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageFlags(global, sharedOpts, "", "")
+	opts := blobExistsOptions{
+		global: global,
+		image:  imageOpts,
+	}
+	return cli.Command{
+		Name:  "exists",
+		Usage: "Check whether the blob with DIGEST exists in the repository of IMAGE-NAME",
+		Description: `
+	Check whether the blob with "DIGEST" exists in the repository of "IMAGE-NAME", a docker:// reference,
+	and write the result to standard output in JSON format
+	`,
+		ArgsUsage: "IMAGE-NAME DIGEST",
+		Action:    commandAction(opts.run),
+		Flags:     append(sharedFlags, imageFlags...),
+	}
+}
+
+func (opts *blobExistsOptions) run(args []string, stdout io.Writer) error {
+	if len(args) != 2 {
+		return errors.New("Usage: skopeo blob exists IMAGE-NAME DIGEST")
+	}
+	ref, err := parseDockerRepository(args[0])
+	if err != nil {
+		return err
+	}
+	blobDigest, err := digest.Parse(args[1])
+	if err != nil {
+		return fmt.Errorf("Invalid digest %s: %v", args[1], err)
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+	exists, size, err := docker.BlobExists(ctx, sys, ref, blobDigest)
+	if err != nil {
+		return err
+	}
+	return writeBlobJSON(stdout, blobExistsOutput{Digest: blobDigest, Exists: exists, Size: size})
+}
+
+type blobMountOptions struct {
+	global *globalOptions
+	image  *imageDestOptions
+}
+
+func blobMountCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageDestFlags(global, sharedOpts, "", "")
+	opts := blobMountOptions{
+		global: global,
+		image:  imageOpts,
+	}
+	return cli.Command{
+		Name:  "mount",
+		Usage: "Make the blob with DIGEST in the repository of SOURCE-IMAGE available in the repository of DESTINATION-IMAGE",
+		Description: `
+	Make the blob with "DIGEST" in the repository of "SOURCE-IMAGE" available in the repository of "DESTINATION-IMAGE",
+	without uploading it, and write the digest and size of the blob to standard output in JSON format
+
+	Both images must be docker:// references on the same registry
+	`,
+		ArgsUsage: "SOURCE-IMAGE DESTINATION-IMAGE DIGEST",
+		Action:    commandAction(opts.run),
+		Flags:     append(sharedFlags, imageFlags...),
+	}
+}
+
+func (opts *blobMountOptions) run(args []string, stdout io.Writer) error {
+	if len(args) != 3 {
+		return errors.New("Usage: skopeo blob mount SOURCE-IMAGE DESTINATION-IMAGE DIGEST")
+	}
+	srcRef, err := parseDockerRepository(args[0])
+	if err != nil {
+		return err
+	}
+	destRef, err := parseDockerRepository(args[1])
+	if err != nil {
+		return err
+	}
+	blobDigest, err := digest.Parse(args[2])
+	if err != nil {
+		return fmt.Errorf("Invalid digest %s: %v", args[2], err)
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+	if err := docker.MountBlob(ctx, sys, srcRef, destRef, blobDigest); err != nil {
+		return err
+	}
+	exists, size, err := docker.BlobExists(ctx, sys, destRef, blobDigest)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("Blob %s does not exist in %s after mounting it", blobDigest, transports.ImageName(destRef))
+	}
+	return writeBlobJSON(stdout, blobOutput{Digest: blobDigest, Size: size})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlob(t *testing.T) {
+	registry := newFakeRegistry()
+	defer registry.Close()
+	img := registry.addImage(t, "app", time.Now(), "linux", "amd64", "contents", "latest")
+	app := "docker://" + registry.host() + "/app"
+	other := "docker://" + registry.host() + "/other"
+
+	tmpDir, err := ioutil.TempDir("", "skopeo-blob")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// get
+	out, err := runSkopeo("blob", "get", "--tls-verify=false", app, img.layer.String())
+	require.NoError(t, err)
+	assert.Equal(t, string(img.layerBlob), out)
+	output := filepath.Join(tmpDir, "layer")
+	out, err = runSkopeo("blob", "get", "--tls-verify=false", "-o", output, app, img.layer.String())
+	require.NoError(t, err)
+	var res blobOutput
+	err = json.Unmarshal([]byte(out), &res)
+	require.NoError(t, err)
+	assert.Equal(t, blobOutput{Digest: img.layer, Size: int64(len(img.layerBlob)), Path: output}, res)
+	contents, err := ioutil.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, img.layerBlob, contents)
+
+	// get verifies the digest
+	corrupt := digest.FromString("corrupt")
+	registry.mu.Lock()
+	registry.blobs[corrupt] = []byte("not matching")
+	registry.mu.Unlock()
+	corruptOutput := filepath.Join(tmpDir, "corrupt")
+	_, err = runSkopeo("blob", "get", "--tls-verify=false", "-o", corruptOutput, app, corrupt.String())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match its digest")
+	_, err = os.Lstat(corruptOutput)
+	assert.True(t, os.IsNotExist(err))
+	files, err := ioutil.ReadDir(tmpDir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1) // The temporary file was removed
+
+	// put
+	data := []byte("uploaded blob")
+	dataDigest := digest.FromBytes(data)
+	dataFile := filepath.Join(tmpDir, "data")
+	err = ioutil.WriteFile(dataFile, data, 0644)
+	require.NoError(t, err)
+	sha512Sum := sha512.Sum512(data)
+	for _, args := range [][]string{{}, {"--digest", dataDigest.String()}, {"--digest", "sha512:" + hex.EncodeToString(sha512Sum[:])}} {
+		out, err = runSkopeo(append(append([]string{"blob", "put", "--tls-verify=false"}, args...), app, dataFile)...)
+		require.NoError(t, err, args)
+		res = blobOutput{}
+		err = json.Unmarshal([]byte(out), &res)
+		require.NoError(t, err, args)
+		assert.Equal(t, blobOutput{Digest: dataDigest, Size: int64(len(data))}, res, args)
+	}
+	assert.Equal(t, data, registry.blobs[dataDigest])
+	out, err = runSkopeo("blob", "put", "--tls-verify=false", "--digest", digest.FromString("other").String(), app, dataFile)
+	assertTestFailed(t, out, err, "does not match digest")
+
+	// put refuses other transports, and does not modify an existing image
+	dirImage := filepath.Join(tmpDir, "dir-image")
+	out, err = runSkopeo("--insecure-policy", "copy", "--src-tls-verify=false", app+":latest", "dir:"+dirImage)
+	require.NoError(t, err)
+	dirFiles := func() []string {
+		files, err := ioutil.ReadDir(dirImage)
+		require.NoError(t, err)
+		res := []string{}
+		for _, f := range files {
+			res = append(res, f.Name())
+		}
+		return res
+	}
+	before := dirFiles()
+	require.Contains(t, before, "manifest.json")
+	out, err = runSkopeo("blob", "put", "dir:"+dirImage, dataFile)
+	assertTestFailed(t, out, err, "Only docker:// repositories are supported")
+	assert.Equal(t, before, dirFiles())
+
+	// exists
+	exists := func(repo string, d digest.Digest) blobExistsOutput {
+		out, err := runSkopeo("blob", "exists", "--tls-verify=false", repo, d.String())
+		require.NoError(t, err)
+		var res blobExistsOutput
+		err = json.Unmarshal([]byte(out), &res)
+		require.NoError(t, err)
+		return res
+	}
+	assert.Equal(t, blobExistsOutput{Digest: dataDigest, Exists: true, Size: int64(len(data))}, exists(app, dataDigest))
+	assert.Equal(t, blobExistsOutput{Digest: dataDigest, Exists: false, Size: -1}, exists(other, dataDigest))
+
+	// mount
+	out, err = runSkopeo("blob", "mount", "--tls-verify=false", app, other, dataDigest.String())
+	require.NoError(t, err)
+	res = blobOutput{}
+	err = json.Unmarshal([]byte(out), &res)
+	require.NoError(t, err)
+	assert.Equal(t, blobOutput{Digest: dataDigest, Size: int64(len(data))}, res)
+	assert.Equal(t, blobExistsOutput{Digest: dataDigest, Exists: true, Size: int64(len(data))}, exists(other, dataDigest))
+
+	// Invalid arguments
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"get", app}, "Usage"},
+		{[]string{"get", app, "sha256:invalid"}, "Invalid digest"},
+		{[]string{"put", app}, "Usage"},
+		{[]string{"exists", "dir:" + tmpDir, dataDigest.String()}, "Only docker:// repositories are supported"},
+		{[]string{"mount", app, "docker://other.example.com/other", dataDigest.String()}, "Can not mount blobs between registries"},
+		{[]string{"mount", app, other, digest.FromString("missing").String()}, fmt.Sprintf("Mounting %s", digest.FromString("missing"))},
+	} {
+		out, err := runSkopeo(append([]string{"blob", c.args[0], "--tls-verify=false"}, c.args[1:]...)...)
+		assertTestFailed(t, out, err, c.expected)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockedRegistry(t *testing.T) {
+	conf, err := ioutil.TempFile("", "registries.conf")
+	require.NoError(t, err)
+	defer os.Remove(conf.Name())
+	_, err = conf.WriteString(`
+[[registry]]
+location = "blocked.invalid"
+blocked = true
+`)
+	require.NoError(t, err)
+	require.NoError(t, conf.Close())
+
+	dir, err := ioutil.TempDir("", "skopeo-blocked")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, args := range [][]string{
+		{"inspect", "docker://blocked.invalid/busybox"},
+		{"inspect", "--raw", "docker://blocked.invalid/busybox:latest"},
+		{"delete", "docker://blocked.invalid/busybox:latest"},
+		{"copy", "docker://blocked.invalid/busybox", "dir:" + dir},
+		{"copy", "dir:" + dir, "docker://blocked.invalid/busybox"},
+		{"layers", "docker://blocked.invalid/busybox"},
+	} {
+		out, err := runSkopeo(append([]string{"--insecure-policy", "--registries-conf", conf.Name()}, args...)...)
+		assertTestFailed(t, out, err, "blocked.invalid is blocked in registries.conf")
+	}
+}
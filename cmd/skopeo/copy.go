@@ -24,7 +24,8 @@ type copyOptions struct {
 	signByFingerprint string          // Sign the image using a GPG key with the specified fingerprint
 	format            optionalString  // Force conversion of the image to a specified format
 	quiet             bool            // Suppress output information when copying images
-
+	all               bool            // Copy all of the images if the source is a manifest list
+	signAllInstances  bool            // With --all and --sign-by, sign each of the images in a manifest list, not only the list
 }
 
 func copyCmd(global *globalOptions) cli.Command {
@@ -72,6 +73,16 @@ func copyCmd(global *globalOptions) cli.Command {
 				Usage:       "Sign the image using a GPG key with the specified `FINGERPRINT`",
 				Destination: &opts.signByFingerprint,
 			},
+			cli.BoolFlag{
+				Name:        "all, a",
+				Usage:       "Copy all images if SOURCE-IMAGE is a list",
+				Destination: &opts.all,
+			},
+			cli.BoolFlag{
+				Name:        "sign-all-instances",
+				Usage:       "With --all and --sign-by, also sign each of the images in the list",
+				Destination: &opts.signAllInstances,
+			},
 			cli.GenericFlag{
 				Name:  "format, f",
 				Usage: "`MANIFEST TYPE` (oci, v2s1, or v2s2) to use when saving image to directory using the 'dir:' transport (default is manifest type of source)",
@@ -97,22 +108,25 @@ func (opts *copyOptions) run(args []string, stdout io.Writer) error {
 	}
 	defer policyContext.Destroy()
 
-	srcRef, err := alltransports.ParseImageName(imageNames[0])
+	sourceCtx, err := opts.srcImage.newSystemContext()
 	if err != nil {
-		return fmt.Errorf("Invalid source name %s: %v", imageNames[0], err)
+		return err
 	}
-	destRef, err := alltransports.ParseImageName(imageNames[1])
+	destinationCtx, err := opts.destImage.newSystemContext()
 	if err != nil {
-		return fmt.Errorf("Invalid destination name %s: %v", imageNames[1], err)
+		return err
 	}
 
-	sourceCtx, err := opts.srcImage.newSystemContext()
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	srcRef, err := parseSourceImageName(ctx, sourceCtx, imageNames[0])
 	if err != nil {
-		return err
+		return fmt.Errorf("Invalid source name %s: %v", imageNames[0], err)
 	}
-	destinationCtx, err := opts.destImage.newSystemContext()
+	destRef, err := alltransports.ParseImageName(imageNames[1])
 	if err != nil {
-		return err
+		return fmt.Errorf("Invalid destination name %s: %v", imageNames[1], err)
 	}
 
 	var manifestType string
@@ -141,8 +155,9 @@ func (opts *copyOptions) run(args []string, stdout io.Writer) error {
 		destinationCtx.DockerArchiveAdditionalTags = append(destinationCtx.DockerArchiveAdditionalTags, namedTagged)
 	}
 
-	ctx, cancel := opts.global.commandTimeoutContext()
-	defer cancel()
+	if opts.signAllInstances && (!opts.all || opts.signByFingerprint == "") {
+		return errors.New("--sign-all-instances can only be used together with --all and --sign-by")
+	}
 
 	if opts.quiet {
 		stdout = nil
@@ -154,6 +169,8 @@ func (opts *copyOptions) run(args []string, stdout io.Writer) error {
 		SourceCtx:             sourceCtx,
 		DestinationCtx:        destinationCtx,
 		ForceManifestMIMEType: manifestType,
+		CopyAllImages:         opts.all,
+		SignAllInstances:      opts.signAllInstances,
 	})
 	return err
 }
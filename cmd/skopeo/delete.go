@@ -1,19 +1,34 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/containers/image/docker"
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/image"
 	"github.com/containers/image/transports"
 	"github.com/containers/image/transports/alltransports"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
 	"github.com/urfave/cli"
 )
 
 type deleteOptions struct {
-	global *globalOptions
-	image  *imageOptions
+	global       *globalOptions
+	image        *imageOptions
+	tagRegex     string        // Only delete images with tags matching this regular expression
+	keepLast     int           // Keep this many most recently created images
+	olderThan    time.Duration // Only delete images created longer than this ago
+	deleteShared bool          // Also delete images referenced by tags which were not selected
+	dryRun       bool          // Only show what would be deleted
+	tagOnly      bool          // Only delete the tag, not the image it refers to
 }
 
 func deleteCmd(global *globalOptions) cli.Command {
@@ -32,35 +47,252 @@ func deleteCmd(global *globalOptions) cli.Command {
 	Supported transports:
 	%s
 
+	With --tag-regex, --keep-last or --older-than, "IMAGE-NAME" is a docker:// repository
+	without a tag, and the images in it are selected for deletion using these options
+
 	See skopeo(1) section "IMAGE NAMES" for the expected format
 	`, strings.Join(transports.ListNames(), ", ")),
 		ArgsUsage: "IMAGE-NAME",
 		Action:    commandAction(opts.run),
-		Flags:     append(sharedFlags, imageFlags...),
+		Flags: append(append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "tag-regex",
+				Usage:       "only delete images with a tag matching `REGEX`",
+				Destination: &opts.tagRegex,
+			},
+			cli.IntFlag{
+				Name:        "keep-last",
+				Usage:       "keep the `N` most recently created selected images",
+				Destination: &opts.keepLast,
+			},
+			cli.DurationFlag{
+				Name:        "older-than",
+				Usage:       "only delete images created more than `DURATION` ago",
+				Destination: &opts.olderThan,
+			},
+			cli.BoolFlag{
+				Name:        "delete-shared",
+				Usage:       "also delete selected images which are referenced by tags which were not selected, removing those tags",
+				Destination: &opts.deleteShared,
+			},
+			cli.BoolFlag{
+				Name:        "tag-only",
+				Usage:       "only delete the tag of a docker:// IMAGE-NAME, refusing to delete an image referenced by other tags",
+				Destination: &opts.tagOnly,
+			},
+			cli.BoolFlag{
+				Name:        "dry-run",
+				Usage:       "only show what would be deleted",
+				Destination: &opts.dryRun,
+			},
+		}, sharedFlags...), imageFlags...),
 	}
 }
 
+// selectingImages returns true if opts select images in a repository to delete, instead of deleting a single image.
+func (opts *deleteOptions) selectingImages() bool {
+	return opts.tagRegex != "" || opts.keepLast != 0 || opts.olderThan != 0
+}
+
 func (opts *deleteOptions) run(args []string, stdout io.Writer) error {
 	if len(args) != 1 {
 		return errors.New("Usage: delete imageReference")
 	}
 	imageName := args[0]
+	if opts.keepLast < 0 || opts.olderThan < 0 {
+		return errors.New("--keep-last and --older-than must not be negative")
+	}
 
 	if err := reexecIfNecessaryForImages(imageName); err != nil {
 		return err
 	}
 
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	if opts.selectingImages() {
+		if opts.tagOnly {
+			return errors.New("--tag-only can not be used when selecting images to delete")
+		}
+		return opts.deleteSelectedImages(ctx, sys, imageName, stdout)
+	}
+	if opts.deleteShared {
+		return errors.New("--delete-shared can only be used when selecting images to delete")
+	}
+
 	ref, err := alltransports.ParseImageName(imageName)
 	if err != nil {
 		return fmt.Errorf("Invalid source name %s: %v", imageName, err)
 	}
+	if opts.tagOnly {
+		if ref.Transport().Name() != docker.Transport.Name() {
+			return fmt.Errorf("--tag-only is only supported for %s:// images, not %s", docker.Transport.Name(), imageName)
+		}
+		if opts.dryRun {
+			fmt.Fprintf(stdout, "Would delete tag %s\n", transports.ImageName(ref))
+			return nil
+		}
+		return docker.DeleteTag(ctx, sys, ref)
+	}
+	if opts.dryRun {
+		fmt.Fprintf(stdout, "Would delete %s\n", transports.ImageName(ref))
+		return nil
+	}
+	return ref.DeleteImage(ctx, sys)
+}
 
-	sys, err := opts.image.newSystemContext()
+// repositoryImage is an image in a repository, considered for deletion by deleteSelectedImages.
+type repositoryImage struct {
+	digest    digest.Digest
+	tags      []string   // Selected tags referencing the image
+	otherTags []string   // Tags referencing the image which were not selected
+	created   *time.Time // nil if unknown
+}
+
+// deleteSelectedImages deletes the images selected by opts in the docker:// repository repoName.
+// Each selected image is deleted exactly once, by digest, even if it is referenced by several tags.
+// Images also referenced by tags which were not selected are kept, unless opts.deleteShared.
+func (opts *deleteOptions) deleteSelectedImages(ctx context.Context, sys *types.SystemContext, repoName string, stdout io.Writer) error {
+	prefix := docker.Transport.Name() + "://"
+	if !strings.HasPrefix(repoName, prefix) {
+		return fmt.Errorf("Selecting images to delete is only supported for %s repositories, not %s", prefix, repoName)
+	}
+	named, err := reference.ParseNormalizedNamed(strings.TrimPrefix(repoName, prefix))
+	if err != nil {
+		return fmt.Errorf("Invalid repository name %s: %v", repoName, err)
+	}
+	if !reference.IsNameOnly(named) {
+		return fmt.Errorf("Repository name %s must not contain a tag or digest when selecting images to delete", repoName)
+	}
+	var tagRegexp *regexp.Regexp
+	if opts.tagRegex != "" {
+		tagRegexp, err = regexp.Compile("^(?:" + opts.tagRegex + ")$")
+		if err != nil {
+			return fmt.Errorf("Invalid --tag-regex %s: %v", opts.tagRegex, err)
+		}
+	}
+
+	repoRef, err := docker.NewReference(reference.TagNameOnly(named))
+	if err != nil {
+		return err
+	}
+	tags, err := docker.GetRepositoryTags(ctx, sys, repoRef)
+	if err != nil {
+		return fmt.Errorf("Error listing tags of %s: %v", named.Name(), err)
+	}
+	tagDigests, err := docker.GetTagDigests(ctx, sys, repoRef, tags)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := opts.global.commandTimeoutContext()
-	defer cancel()
-	return ref.DeleteImage(ctx, sys)
+	imagesByDigest := map[digest.Digest]*repositoryImage{}
+	candidates := []*repositoryImage{}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		d := tagDigests[tag]
+		img, ok := imagesByDigest[d]
+		if !ok {
+			img = &repositoryImage{digest: d}
+			imagesByDigest[d] = img
+		}
+		if tagRegexp == nil || tagRegexp.MatchString(tag) {
+			if len(img.tags) == 0 {
+				candidates = append(candidates, img)
+			}
+			img.tags = append(img.tags, tag)
+		} else {
+			img.otherTags = append(img.otherTags, tag)
+		}
+	}
+
+	if opts.keepLast != 0 || opts.olderThan != 0 {
+		for _, img := range candidates {
+			created, err := imageCreated(ctx, sys, named, img.digest)
+			if err != nil {
+				return err
+			}
+			img.created = created
+		}
+		// Most recent first; images with an unknown creation time are considered the oldest.
+		sort.SliceStable(candidates, func(i, j int) bool {
+			ci, cj := candidates[i].created, candidates[j].created
+			return ci != nil && (cj == nil || ci.After(*cj))
+		})
+	}
+
+	toDelete := []*repositoryImage{}
+	cutoff := time.Now().Add(-opts.olderThan)
+	for i, img := range candidates {
+		switch {
+		case i < opts.keepLast:
+		case opts.olderThan != 0 && (img.created == nil || !img.created.Before(cutoff)):
+		case !opts.deleteShared && len(img.otherTags) != 0:
+			digested, err := reference.WithDigest(named, img.digest)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "Keeping %s (tags: %s), also referenced by tags which were not selected: %s\n", digested.String(),
+				strings.Join(img.tags, ", "), strings.Join(img.otherTags, ", "))
+		default:
+			toDelete = append(toDelete, img)
+		}
+	}
+
+	for _, img := range toDelete {
+		digested, err := reference.WithDigest(named, img.digest)
+		if err != nil {
+			return err
+		}
+		description := fmt.Sprintf("%s (tags: %s)", digested.String(), strings.Join(append(append([]string{}, img.tags...), img.otherTags...), ", "))
+		if opts.dryRun {
+			fmt.Fprintf(stdout, "Would delete %s\n", description)
+			continue
+		}
+		ref, err := docker.NewReference(digested)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Deleting %s\n", description)
+		if err := ref.DeleteImage(ctx, sys); err != nil {
+			return fmt.Errorf("Error deleting %s: %v", digested.String(), err)
+		}
+	}
+	return nil
+}
+
+// imageCreated returns the creation time recorded in the configuration of the image with manifestDigest in the repository named,
+// or nil if it is not known.
+func imageCreated(ctx context.Context, sys *types.SystemContext, named reference.Named, manifestDigest digest.Digest) (retTime *time.Time, retErr error) {
+	digested, err := reference.WithDigest(named, manifestDigest)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := docker.NewReference(digested)
+	if err != nil {
+		return nil, err
+	}
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	img, err := image.FromSource(ctx, sys, src)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("Error reading %s: %v", digested.String(), err)
+	}
+	defer func() {
+		if err := img.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+	info, err := img.Inspect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading configuration of %s: %v", digested.String(), err)
+	}
+	return info.Created, nil
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteSelectedImages(t *testing.T) {
+	registry := newFakeRegistry()
+	defer registry.Close()
+	repo := "docker://" + registry.host() + "/ci/app"
+	now := time.Now()
+	day := 24 * time.Hour
+
+	// Tags pointing to one image are grouped, and the image is deleted only once.
+	old := registry.addImage(t, "ci/app", now.Add(-30*day), "linux", "amd64", "old", "pr-1", "pr-1-retry")
+	middle := registry.addImage(t, "ci/app", now.Add(-10*day), "linux", "amd64", "middle", "pr-2", "stable")
+	recent := registry.addImage(t, "ci/app", now.Add(-1*day), "linux", "amd64", "recent", "pr-3")
+	newest := registry.addImage(t, "ci/app", now, "linux", "amd64", "newest", "pr-4", "latest")
+	name := registry.host() + "/ci/app@"
+
+	deleteImages := func(args ...string) string {
+		out, err := runSkopeo(append(append([]string{"delete", "--tls-verify=false"}, args...), repo)...)
+		require.NoError(t, err, strings.Join(args, " "))
+		return out
+	}
+
+	// Dry runs
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		// Images also referenced by tags which were not selected are kept by default.
+		{[]string{"--tag-regex", "pr-.*"}, fmt.Sprintf("Keeping %s%s (tags: pr-2), also referenced by tags which were not selected: stable\n", name, middle.digest) +
+			fmt.Sprintf("Keeping %s%s (tags: pr-4), also referenced by tags which were not selected: latest\n", name, newest.digest) +
+			fmt.Sprintf("Would delete %s%s (tags: pr-1, pr-1-retry)\n", name, old.digest) +
+			fmt.Sprintf("Would delete %s%s (tags: pr-3)\n", name, recent.digest)},
+		{[]string{"--tag-regex", "pr-.*", "--delete-shared"}, fmt.Sprintf("Would delete %s%s (tags: pr-1, pr-1-retry)\n", name, old.digest) +
+			fmt.Sprintf("Would delete %s%s (tags: pr-2, stable)\n", name, middle.digest) +
+			fmt.Sprintf("Would delete %s%s (tags: pr-3)\n", name, recent.digest) +
+			fmt.Sprintf("Would delete %s%s (tags: pr-4, latest)\n", name, newest.digest)},
+		{[]string{"--tag-regex", "pr"}, ""}, // The expression must match the whole tag
+		{[]string{"--tag-regex", "pr-.*", "--keep-last", "2"}, fmt.Sprintf("Keeping %s%s (tags: pr-2), also referenced by tags which were not selected: stable\n", name, middle.digest) +
+			fmt.Sprintf("Would delete %s%s (tags: pr-1, pr-1-retry)\n", name, old.digest)},
+		{[]string{"--tag-regex", "pr-.*", "--keep-last", "2", "--delete-shared"}, fmt.Sprintf("Would delete %s%s (tags: pr-2, stable)\n", name, middle.digest) +
+			fmt.Sprintf("Would delete %s%s (tags: pr-1, pr-1-retry)\n", name, old.digest)},
+		{[]string{"--older-than", "240h"}, fmt.Sprintf("Would delete %s%s (tags: pr-2, stable)\n", name, middle.digest) +
+			fmt.Sprintf("Would delete %s%s (tags: pr-1, pr-1-retry)\n", name, old.digest)},
+		{[]string{"--keep-last", "3", "--older-than", "48h"}, fmt.Sprintf("Would delete %s%s (tags: pr-1, pr-1-retry)\n", name, old.digest)},
+	} {
+		out := deleteImages(append([]string{"--dry-run"}, c.args...)...)
+		assert.Equal(t, c.expected, out, strings.Join(c.args, " "))
+	}
+	assert.Equal(t, []string{"latest", "pr-1", "pr-1-retry", "pr-2", "pr-3", "pr-4", "stable"}, registry.tagsOf("ci/app"))
+
+	// Actual deletion
+	registry.readAllRequests()
+	out := deleteImages("--tag-regex", "pr-[0-9]+(-retry)?", "--keep-last", "1")
+	assert.Equal(t, fmt.Sprintf("Keeping %s%s (tags: pr-2), also referenced by tags which were not selected: stable\n", name, middle.digest)+
+		fmt.Sprintf("Deleting %s%s (tags: pr-3)\n", name, recent.digest)+
+		fmt.Sprintf("Deleting %s%s (tags: pr-1, pr-1-retry)\n", name, old.digest), out)
+	assert.Equal(t, []string{"latest", "pr-2", "pr-4", "stable"}, registry.tagsOf("ci/app"))
+	deletes := []string{}
+	for _, req := range registry.readAllRequests() {
+		if strings.HasPrefix(req, "DELETE ") {
+			deletes = append(deletes, req)
+		}
+	}
+	assert.Equal(t, []string{"DELETE /v2/ci/app/manifests/" + recent.digest.String(), "DELETE /v2/ci/app/manifests/" + old.digest.String()}, deletes)
+
+	// Invalid arguments
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--tag-regex", "pr-.*", repo + ":latest"}, "must not contain a tag or digest"},
+		{[]string{"--tag-regex", "pr-.*", "dir:/tmp"}, "only supported for docker://"},
+		{[]string{"--tag-regex", "(", repo}, "Invalid --tag-regex"},
+		{[]string{"--keep-last", "-1", repo}, "must not be negative"},
+		{[]string{"--delete-shared", repo + ":latest"}, "--delete-shared can only be used when selecting images"},
+	} {
+		out, err := runSkopeo(append([]string{"delete", "--tls-verify=false"}, c.args...)...)
+		assertTestFailed(t, out, err, c.expected)
+	}
+}
+
+func TestDeleteTagOnly(t *testing.T) {
+	for _, c := range []struct {
+		status      int  // Of DELETE /v2/<name>/manifests/<tag>
+		tagDeletion bool // The registry supports deleting tags
+	}{
+		{http.StatusAccepted, true},
+		{http.StatusNoContent, true},
+		{http.StatusBadRequest, false}, // With an UNSUPPORTED error
+		{http.StatusNotFound, false},
+		{http.StatusMethodNotAllowed, false},
+	} {
+		registry := newFakeRegistry()
+		registry.tagDeletionStatus = c.status
+		now := time.Now()
+		shared := registry.addImage(t, "app", now, "linux", "amd64", "shared", "v1", "v1.0", "latest")
+		registry.addImage(t, "app", now, "linux", "amd64", "single", "v2")
+		image := "docker://" + registry.host() + "/app:"
+
+		out, err := runSkopeo("delete", "--tls-verify=false", "--tag-only", "--dry-run", image+"v1")
+		require.NoError(t, err)
+		assert.Equal(t, "Would delete tag "+image+"v1\n", out)
+
+		out, err = runSkopeo("delete", "--tls-verify=false", "--tag-only", image+"v1")
+		if c.tagDeletion {
+			require.NoError(t, err, "status %d", c.status)
+			assert.Equal(t, []string{"latest", "v1.0", "v2"}, registry.tagsOf("app"))
+			assert.Contains(t, registry.manifests, shared.digest)
+		} else {
+			assertTestFailed(t, out, err, "would also remove tags [latest v1.0]")
+			assert.Equal(t, []string{"latest", "v1", "v1.0", "v2"}, registry.tagsOf("app"))
+		}
+
+		// An image referenced by a single tag is deleted even if the registry does not support deleting tags.
+		out, err = runSkopeo("delete", "--tls-verify=false", "--tag-only", image+"v2")
+		require.NoError(t, err)
+		assert.NotContains(t, registry.tagsOf("app"), "v2")
+
+		out, err = runSkopeo("delete", "--tls-verify=false", "--tag-only", image+"missing")
+		assertTestFailed(t, out, err, "missing")
+		registry.Close()
+	}
+
+	// Other errors are reported, and the image is not deleted instead.
+	registry := newFakeRegistry()
+	defer registry.Close()
+	registry.tagDeletionStatus = http.StatusInternalServerError
+	img := registry.addImage(t, "app", time.Now(), "linux", "amd64", "single", "v1")
+	out, err := runSkopeo("delete", "--tls-verify=false", "--tag-only", "docker://"+registry.host()+"/app:v1")
+	assertTestFailed(t, out, err, "Error deleting tag")
+	assert.Equal(t, []string{"v1"}, registry.tagsOf("app"))
+	assert.Contains(t, registry.manifests, img.digest)
+
+	out, err = runSkopeo("delete", "--tag-only", "dir:/tmp")
+	assertTestFailed(t, out, err, "only supported for docker://")
+	out, err = runSkopeo("delete", "--tag-only", "--tag-regex", "v.*", "docker://example.com/app")
+	assertTestFailed(t, out, err, "--tag-only can not be used")
+}
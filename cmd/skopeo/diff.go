@@ -0,0 +1,476 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containers/image/image"
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/pkg/blobinfocache"
+	"github.com/containers/image/pkg/compression"
+	"github.com/containers/image/transports"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+type diffOptions struct {
+	global *globalOptions
+	image  *imageOptions
+	files  bool // Also compare the files in the layers
+}
+
+func diffCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageFlags(global, sharedOpts, "", "")
+	opts := diffOptions{
+		global: global,
+		image:  imageOpts,
+	}
+	return cli.Command{
+		Name:  "diff",
+		Usage: "Compare images IMAGE-NAME1 and IMAGE-NAME2",
+		Description: fmt.Sprintf(`
+	Compare the manifests and configurations of "IMAGE-NAME1" and "IMAGE-NAME2", and the layers they contain
+
+	With --files, also compare the files in the images, reading all of their layers
+
+	Supported transports:
+	%s
+
+	See skopeo(1) section "IMAGE NAMES" for the expected format
+	`, strings.Join(transports.ListNames(), ", ")),
+		ArgsUsage: "IMAGE-NAME1 IMAGE-NAME2",
+		Flags: append(append([]cli.Flag{
+			cli.BoolFlag{
+				Name:        "files",
+				Usage:       "compare files in the layers of the images",
+				Destination: &opts.files,
+			},
+		}, sharedFlags...), imageFlags...),
+		Action: commandAction(opts.run),
+	}
+}
+
+// diffOutput is the output format of (skopeo diff), primarily so that we can format it with a simple json.MarshalIndent.
+type diffOutput struct {
+	Differences  []diffField // Differences in the manifests and configurations
+	SharedLayers []diffLayer // Layers in both images, in the order of IMAGE-NAME1
+	Image1Layers []diffLayer // Layers only in IMAGE-NAME1
+	Image2Layers []diffLayer // Layers only in IMAGE-NAME2
+	Files        *diffFiles  `json:",omitempty"` // Set only with --files
+}
+
+// diffField is a difference between values of a field in the two images; the value is nil if it is not set.
+type diffField struct {
+	Field  string
+	Image1 interface{}
+	Image2 interface{}
+}
+
+// diffLayer identifies a layer in diffOutput.
+type diffLayer struct {
+	Digest digest.Digest
+	DiffID digest.Digest `json:",omitempty"` // Empty if not known
+}
+
+// diffFiles is a file-level difference between the two images.
+type diffFiles struct {
+	Added     []string // Paths only in IMAGE-NAME2
+	Removed   []string // Paths only in IMAGE-NAME1
+	Modified  []string // Paths with different type, mode, owner, size, link target or contents
+	Whiteouts []string // Paths removed by whiteouts in layers of IMAGE-NAME2 which are not in IMAGE-NAME1
+}
+
+// diffImage is an image being compared.
+type diffImage struct {
+	img       types.ImageCloser
+	src       types.ImageSource
+	digest    digest.Digest
+	mediaType string
+	config    *imgspecv1.Image
+	layers    []diffLayer
+	blobInfos []types.BlobInfo // Corresponds to layers
+}
+
+func (opts *diffOptions) run(args []string, stdout io.Writer) (retErr error) {
+	if len(args) != 2 {
+		return errors.New("Usage: skopeo diff IMAGE-NAME1 IMAGE-NAME2")
+	}
+
+	if err := reexecIfNecessaryForImages(args...); err != nil {
+		return err
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+
+	images := make([]*diffImage, len(args))
+	for i, imageName := range args {
+		img, err := openDiffImage(ctx, sys, imageName)
+		if err != nil {
+			return err
+		}
+		images[i] = img
+		defer func() {
+			if err := img.img.Close(); err != nil {
+				retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+			}
+		}()
+	}
+	image1, image2 := images[0], images[1]
+
+	res := diffOutput{
+		Differences:  diffFields(image1, image2),
+		SharedLayers: []diffLayer{},
+		Image1Layers: []diffLayer{},
+		Image2Layers: []diffLayer{},
+	}
+	for _, layer := range image1.layers {
+		if image2.hasLayer(layer) {
+			res.SharedLayers = append(res.SharedLayers, layer)
+		} else {
+			res.Image1Layers = append(res.Image1Layers, layer)
+		}
+	}
+	for _, layer := range image2.layers {
+		if !image1.hasLayer(layer) {
+			res.Image2Layers = append(res.Image2Layers, layer)
+		}
+	}
+
+	if opts.files {
+		res.Files, err = diffImageFiles(ctx, sys, image1, image2)
+		if err != nil {
+			return err
+		}
+	}
+
+	out, err := json.MarshalIndent(res, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s\n", string(out))
+	return nil
+}
+
+// openDiffImage opens imageName and reads the data compared by (skopeo diff).
+// The caller must call .img.Close() on the returned value.
+func openDiffImage(ctx context.Context, sys *types.SystemContext, imageName string) (*diffImage, error) {
+	ref, err := parseSourceImageName(ctx, sys, imageName)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid image name %s: %v", imageName, err)
+	}
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	img, err := image.FromSource(ctx, sys, src)
+	if err != nil {
+		if closeErr := src.Close(); closeErr != nil {
+			return nil, errors.Wrapf(err, " (close error: %v)", closeErr)
+		}
+		return nil, err
+	}
+	res := &diffImage{img: img, src: src}
+	if err := res.load(ctx, imageName); err != nil {
+		if closeErr := img.Close(); closeErr != nil {
+			return nil, errors.Wrapf(err, " (close error: %v)", closeErr)
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// load reads the manifest, configuration and layers of i, named imageName.
+func (i *diffImage) load(ctx context.Context, imageName string) error {
+	rawManifest, mediaType, err := i.img.Manifest(ctx)
+	if err != nil {
+		return err
+	}
+	if i.digest, err = manifest.Digest(rawManifest); err != nil {
+		return fmt.Errorf("Error computing manifest digest of %s: %v", imageName, err)
+	}
+	i.mediaType = mediaType
+	if i.config, err = i.img.OCIConfig(ctx); err != nil {
+		return fmt.Errorf("Error reading configuration of %s: %v", imageName, err)
+	}
+	i.blobInfos = i.img.LayerInfos()
+	diffIDs := i.config.RootFS.DiffIDs
+	for j, info := range i.blobInfos {
+		layer := diffLayer{Digest: info.Digest}
+		if len(diffIDs) == len(i.blobInfos) {
+			layer.DiffID = diffIDs[j]
+		}
+		i.layers = append(i.layers, layer)
+	}
+	return nil
+}
+
+// hasLayer returns true if i contains a layer with the digest or diffID of layer.
+func (i *diffImage) hasLayer(layer diffLayer) bool {
+	for _, l := range i.layers {
+		if l.Digest == layer.Digest || (layer.DiffID != "" && l.DiffID == layer.DiffID) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffFields returns the differences between the manifests and configurations of image1 and image2.
+func diffFields(image1, image2 *diffImage) []diffField {
+	res := []diffField{}
+	compare := func(field string, v1, v2 interface{}) {
+		if !reflect.DeepEqual(v1, v2) {
+			res = append(res, diffField{Field: field, Image1: v1, Image2: v2})
+		}
+	}
+	compareMaps := func(field string, m1, m2 map[string]string) {
+		keys := map[string]struct{}{}
+		for k := range m1 {
+			keys[k] = struct{}{}
+		}
+		for k := range m2 {
+			keys[k] = struct{}{}
+		}
+		sortedKeys := []string{}
+		for k := range keys {
+			sortedKeys = append(sortedKeys, k)
+		}
+		sort.Strings(sortedKeys)
+		for _, k := range sortedKeys {
+			compare(field+"."+k, optionalMapValue(m1, k), optionalMapValue(m2, k))
+		}
+	}
+
+	c1, c2 := image1.config, image2.config
+	compare("Digest", image1.digest, image2.digest)
+	compare("MediaType", image1.mediaType, image2.mediaType)
+	compare("Architecture", c1.Architecture, c2.Architecture)
+	compare("Os", c1.OS, c2.OS)
+	compare("Created", optionalTime(c1.Created), optionalTime(c2.Created))
+	compare("Author", c1.Author, c2.Author)
+	compareMaps("Labels", c1.Config.Labels, c2.Config.Labels)
+	compareMaps("Env", envMap(c1.Config.Env), envMap(c2.Config.Env))
+	compare("Entrypoint", c1.Config.Entrypoint, c2.Config.Entrypoint)
+	compare("Cmd", c1.Config.Cmd, c2.Config.Cmd)
+	compare("User", c1.Config.User, c2.Config.User)
+	compare("WorkingDir", c1.Config.WorkingDir, c2.Config.WorkingDir)
+	compare("ExposedPorts", sortedKeys(c1.Config.ExposedPorts), sortedKeys(c2.Config.ExposedPorts))
+	compare("Volumes", sortedKeys(c1.Config.Volumes), sortedKeys(c2.Config.Volumes))
+	compare("StopSignal", c1.Config.StopSignal, c2.Config.StopSignal)
+	return res
+}
+
+// optionalMapValue returns m[key], or nil if it is not set.
+func optionalMapValue(m map[string]string, key string) interface{} {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	return nil
+}
+
+// optionalTime returns t formatted as in JSON, or nil if it is not set.
+func optionalTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// envMap converts a list of NAME=VALUE environment variables to a map.
+func envMap(env []string) map[string]string {
+	res := map[string]string{}
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 {
+			res[kv[0]] = kv[1]
+		} else {
+			res[kv[0]] = ""
+		}
+	}
+	return res
+}
+
+// sortedKeys returns the sorted keys of m.
+func sortedKeys(m map[string]struct{}) []string {
+	res := []string{}
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// diffFileInfo is the metadata of a file compared by (skopeo diff --files).
+// Modification times are not compared, they are usually different in rebuilt images.
+type diffFileInfo struct {
+	typeflag byte
+	mode     int64
+	uid, gid int
+	size     int64
+	linkname string
+	digest   digest.Digest // Of the contents of a regular file
+}
+
+// diffLayerEntry is an entry in a layer, a file or a whiteout.
+type diffLayerEntry struct {
+	path     string
+	whiteout bool // path, and anything below it, is removed
+	opaque   bool // Everything below path from lower layers is removed
+	info     diffFileInfo
+}
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+// diffImageFiles returns the differences between files in image1 and image2.
+func diffImageFiles(ctx context.Context, sys *types.SystemContext, image1, image2 *diffImage) (*diffFiles, error) {
+	cache := blobinfocache.DefaultCache(sys)
+	layerCache := map[digest.Digest][]diffLayerEntry{}
+	files1, _, err := image1.files(ctx, cache, layerCache, nil)
+	if err != nil {
+		return nil, err
+	}
+	files2, whiteouts, err := image2.files(ctx, cache, layerCache, image1)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &diffFiles{Added: []string{}, Removed: []string{}, Modified: []string{}, Whiteouts: whiteouts}
+	for p, info2 := range files2 {
+		info1, ok := files1[p]
+		switch {
+		case !ok:
+			res.Added = append(res.Added, p)
+		case info1 != info2:
+			res.Modified = append(res.Modified, p)
+		}
+	}
+	for p := range files1 {
+		if _, ok := files2[p]; !ok {
+			res.Removed = append(res.Removed, p)
+		}
+	}
+	sort.Strings(res.Added)
+	sort.Strings(res.Removed)
+	sort.Strings(res.Modified)
+	return res, nil
+}
+
+// files returns the files in i after applying all of its layers, reusing and updating layerCache.
+// It also returns the sorted paths removed by whiteouts in layers which are not in other, if other is not nil.
+func (i *diffImage) files(ctx context.Context, cache types.BlobInfoCache, layerCache map[digest.Digest][]diffLayerEntry, other *diffImage) (map[string]diffFileInfo, []string, error) {
+	files := map[string]diffFileInfo{}
+	whiteouts := []string{}
+	for j, info := range i.blobInfos {
+		entries, ok := layerCache[info.Digest]
+		if !ok {
+			var err error
+			entries, err = readLayerEntries(ctx, i.src, info, cache)
+			if err != nil {
+				return nil, nil, err
+			}
+			layerCache[info.Digest] = entries
+		}
+		reportWhiteouts := other != nil && !other.hasLayer(i.layers[j])
+		// Whiteouts only apply to lower layers, so process them before adding files in this layer.
+		for _, e := range entries {
+			if !e.whiteout && !e.opaque {
+				continue
+			}
+			if e.whiteout {
+				delete(files, e.path)
+				if reportWhiteouts {
+					whiteouts = append(whiteouts, e.path)
+				}
+			}
+			prefix := strings.TrimSuffix(e.path, "/") + "/"
+			for p := range files {
+				if strings.HasPrefix(p, prefix) {
+					delete(files, p)
+				}
+			}
+		}
+		for _, e := range entries {
+			if !e.whiteout && !e.opaque {
+				files[e.path] = e.info
+			}
+		}
+	}
+	sort.Strings(whiteouts)
+	return files, whiteouts, nil
+}
+
+// readLayerEntries reads the layer described by info from src, and returns the entries it contains.
+func readLayerEntries(ctx context.Context, src types.ImageSource, info types.BlobInfo, cache types.BlobInfoCache) ([]diffLayerEntry, error) {
+	blob, _, err := src.GetBlob(ctx, info, cache)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading layer %s: %v", info.Digest, err)
+	}
+	defer blob.Close()
+	stream, _, err := compression.AutoDecompress(blob)
+	if err != nil {
+		return nil, fmt.Errorf("Error decompressing layer %s: %v", info.Digest, err)
+	}
+	defer stream.Close()
+
+	entries := []diffLayerEntry{}
+	tr := tar.NewReader(stream)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading layer %s: %v", info.Digest, err)
+		}
+		p := path.Clean("/" + hdr.Name)
+		if p == "/" {
+			continue
+		}
+		dir, base := path.Split(p)
+		switch {
+		case base == whiteoutOpaque:
+			entries = append(entries, diffLayerEntry{path: path.Clean(dir), opaque: true})
+		case strings.HasPrefix(base, whiteoutPrefix):
+			entries = append(entries, diffLayerEntry{path: path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), whiteout: true})
+		default:
+			fileInfo := diffFileInfo{
+				typeflag: hdr.Typeflag,
+				mode:     hdr.Mode,
+				uid:      hdr.Uid,
+				gid:      hdr.Gid,
+				size:     hdr.Size,
+				linkname: hdr.Linkname,
+			}
+			if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
+				digester := digest.Canonical.Digester()
+				if _, err := io.Copy(digester.Hash(), tr); err != nil {
+					return nil, fmt.Errorf("Error reading %s in layer %s: %v", p, info.Digest, err)
+				}
+				fileInfo.typeflag = tar.TypeReg
+				fileInfo.digest = digester.Digest()
+			}
+			entries = append(entries, diffLayerEntry{path: p, info: fileInfo})
+		}
+	}
+	return entries, nil
+}
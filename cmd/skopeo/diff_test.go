@@ -0,0 +1,101 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	registry := newFakeRegistry()
+	defer registry.Close()
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	base, baseDiffID, _ := registry.addLayer(t, []fakeFile{
+		{name: "etc/", typeflag: tar.TypeDir},
+		{name: "etc/config", contents: "v1"},
+		{name: "etc/removed", contents: "x"},
+		{name: "data/", typeflag: tar.TypeDir},
+		{name: "data/old", contents: "old"},
+		{name: "bin/", typeflag: tar.TypeDir},
+		{name: "bin/sh", contents: "shell"},
+	})
+	app1, app1DiffID, _ := registry.addLayer(t, []fakeFile{{name: "app", contents: "app v1"}})
+	app2, app2DiffID, _ := registry.addLayer(t, []fakeFile{
+		{name: "app", contents: "app v2"},
+		{name: "etc/config", contents: "v2"},
+		{name: "etc/.wh.removed"},
+		{name: "data/.wh..wh..opq"},
+		{name: "data/new", contents: "new"},
+		{name: "bin/bash", typeflag: tar.TypeSymlink, linkname: "sh"},
+	})
+	config := func(env []string, labels map[string]string, cmd string) map[string]interface{} {
+		return map[string]interface{}{
+			"created":      created.Format(time.RFC3339Nano),
+			"architecture": "amd64",
+			"os":           "linux",
+			"config":       map[string]interface{}{"Env": env, "Labels": labels, "Cmd": []string{cmd}},
+		}
+	}
+	d1, _ := registry.addImageWithLayers(t, "app", config([]string{"PATH=/bin", "VERSION=1"}, map[string]string{"release": "prod", "old": "yes"}, "/app"),
+		[]digest.Digest{base, app1}, []digest.Digest{baseDiffID, app1DiffID}, "prod")
+	d2, _ := registry.addImageWithLayers(t, "app", config([]string{"PATH=/bin", "VERSION=2"}, map[string]string{"release": "rc"}, "/app --new"),
+		[]digest.Digest{base, app2}, []digest.Digest{baseDiffID, app2DiffID}, "rc")
+	image1 := "docker://" + registry.host() + "/app:prod"
+	image2 := "docker://" + registry.host() + "/app:rc"
+
+	out, err := runSkopeo("diff", "--tls-verify=false", image1, image2)
+	require.NoError(t, err)
+	var res diffOutput
+	err = json.Unmarshal([]byte(out), &res)
+	require.NoError(t, err)
+	assert.Equal(t, []diffField{
+		{Field: "Digest", Image1: d1.String(), Image2: d2.String()},
+		{Field: "Labels.old", Image1: "yes", Image2: nil},
+		{Field: "Labels.release", Image1: "prod", Image2: "rc"},
+		{Field: "Env.VERSION", Image1: "1", Image2: "2"},
+		{Field: "Cmd", Image1: []interface{}{"/app"}, Image2: []interface{}{"/app --new"}},
+	}, res.Differences)
+	assert.Equal(t, []diffLayer{{Digest: base, DiffID: baseDiffID}}, res.SharedLayers)
+	assert.Equal(t, []diffLayer{{Digest: app1, DiffID: app1DiffID}}, res.Image1Layers)
+	assert.Equal(t, []diffLayer{{Digest: app2, DiffID: app2DiffID}}, res.Image2Layers)
+	assert.Nil(t, res.Files)
+
+	out, err = runSkopeo("diff", "--tls-verify=false", "--files", image1, image2)
+	require.NoError(t, err)
+	res = diffOutput{}
+	err = json.Unmarshal([]byte(out), &res)
+	require.NoError(t, err)
+	require.NotNil(t, res.Files)
+	assert.Equal(t, diffFiles{
+		Added:     []string{"/bin/bash", "/data/new"},
+		Removed:   []string{"/data/old", "/etc/removed"},
+		Modified:  []string{"/app", "/etc/config"},
+		Whiteouts: []string{"/etc/removed"},
+	}, *res.Files)
+
+	// Identical images
+	out, err = runSkopeo("diff", "--tls-verify=false", "--files", image1, image1)
+	require.NoError(t, err)
+	res = diffOutput{}
+	err = json.Unmarshal([]byte(out), &res)
+	require.NoError(t, err)
+	assert.Equal(t, diffOutput{
+		Differences:  []diffField{},
+		SharedLayers: []diffLayer{{Digest: base, DiffID: baseDiffID}, {Digest: app1, DiffID: app1DiffID}},
+		Image1Layers: []diffLayer{},
+		Image2Layers: []diffLayer{},
+		Files:        &diffFiles{Added: []string{}, Removed: []string{}, Modified: []string{}, Whiteouts: []string{}},
+	}, res)
+
+	// Invalid arguments
+	out, err = runSkopeo("diff", "--tls-verify=false", image1)
+	assertTestFailed(t, out, err, "Usage")
+	out, err = runSkopeo("diff", "--tls-verify=false", image1, "docker://"+registry.host()+"/app:missing")
+	assertTestFailed(t, out, err, "Error reading manifest missing")
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/containers/buildah/pkg/unshare"
+	"github.com/containers/image/image"
+	"github.com/containers/image/pkg/blobinfocache"
+	"github.com/containers/image/pkg/compression"
+	"github.com/containers/image/transports"
+	"github.com/containers/image/types"
+	"github.com/containers/storage/pkg/archive"
+	"github.com/containers/storage/pkg/chrootarchive"
+	"github.com/containers/storage/pkg/idtools"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+type extractOptions struct {
+	global        *globalOptions
+	image         *imageOptions
+	uidMap        cli.StringSlice // CONTAINER:HOST:SIZE mappings of user IDs in the image to user IDs of the extracted files
+	gidMap        cli.StringSlice // CONTAINER:HOST:SIZE mappings of group IDs in the image to group IDs of the extracted files
+	verifyDiffIDs bool            // Verify that the uncompressed layers match the diffIDs in the image configuration
+}
+
+func extractCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageFlags(global, sharedOpts, "", "")
+	opts := extractOptions{
+		global: global,
+		image:  imageOpts,
+	}
+	return cli.Command{
+		Name:  "extract",
+		Usage: "Extract the root filesystem of IMAGE-NAME to DIRECTORY",
+		Description: fmt.Sprintf(`
+	Apply the layers of "IMAGE-NAME", in order, to "DIRECTORY", which must be empty or not exist
+
+	Supported transports:
+	%s
+
+	See skopeo(1) section "IMAGE NAMES" for the expected format
+	`, strings.Join(transports.ListNames(), ", ")),
+		ArgsUsage: "IMAGE-NAME DIRECTORY",
+		Flags: append(append([]cli.Flag{
+			cli.StringSliceFlag{
+				Name:  "uidmap",
+				Usage: "map user IDs in the image to user IDs of the extracted files, using `CONTAINER:HOST:SIZE` mappings",
+				Value: &opts.uidMap, // Surprisingly StringSliceFlag does not support Destination:, but modifies Value: in place.
+			},
+			cli.StringSliceFlag{
+				Name:  "gidmap",
+				Usage: "map group IDs in the image to group IDs of the extracted files, using `CONTAINER:HOST:SIZE` mappings",
+				Value: &opts.gidMap, // Surprisingly StringSliceFlag does not support Destination:, but modifies Value: in place.
+			},
+			cli.BoolFlag{
+				Name:        "verify-diffids",
+				Usage:       "verify that the uncompressed layers match the diffIDs in the image configuration",
+				Destination: &opts.verifyDiffIDs,
+			},
+		}, sharedFlags...), imageFlags...),
+		Action: commandAction(opts.run),
+	}
+}
+
+func (opts *extractOptions) run(args []string, stdout io.Writer) (retErr error) {
+	if len(args) != 2 {
+		return errors.New("Usage: skopeo extract IMAGE-NAME DIRECTORY")
+	}
+	imageName, destDir := args[0], args[1]
+
+	uidMap, gidMap, err := unshare.ParseIDMappings(opts.uidMap, opts.gidMap)
+	if err != nil {
+		return err
+	}
+	if len(uidMap) != 0 || len(gidMap) != 0 {
+		// Files can be owned by the mapped IDs only with the necessary capabilities, possibly in a user namespace.
+		if err := maybeReexec(); err != nil {
+			return err
+		}
+	} else if err := reexecIfNecessaryForImages(imageName); err != nil {
+		return err
+	}
+
+	if err := checkExtractDestination(destDir); err != nil {
+		return err
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+	rawSource, err := parseImageSource(ctx, opts.image, imageName)
+	if err != nil {
+		return err
+	}
+	img, err := image.FromSource(ctx, sys, rawSource)
+	if err != nil {
+		if closeErr := rawSource.Close(); closeErr != nil {
+			return errors.Wrapf(err, " (close error: %v)", closeErr)
+		}
+		return err
+	}
+	defer func() {
+		if err := img.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		}
+	}()
+
+	layers := img.LayerInfos()
+	var diffIDs []digest.Digest
+	if opts.verifyDiffIDs {
+		config, err := img.OCIConfig(ctx)
+		if err != nil {
+			return fmt.Errorf("Error reading OCI-formatted configuration data: %v", err)
+		}
+		diffIDs = config.RootFS.DiffIDs
+		if len(diffIDs) != len(layers) {
+			return fmt.Errorf("The image contains %d layers, but the configuration lists %d diffIDs", len(layers), len(diffIDs))
+		}
+	}
+
+	tarOptions := &archive.TarOptions{
+		UIDMaps:  uidMap,
+		GIDMaps:  gidMap,
+		InUserNS: unshare.IsRootless(), // Ignore EPERM when setting extended attributes
+	}
+	if unshare.IsRootless() && len(uidMap) == 0 && len(gidMap) == 0 {
+		// The ownership in the image can not be preserved, so the files are owned by the current user.
+		tarOptions.ChownOpts = &idtools.IDPair{UID: os.Getuid(), GID: os.Getgid()}
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+	cache := blobinfocache.DefaultCache(sys)
+	for i, layer := range layers {
+		fmt.Fprintf(stdout, "Applying layer %s\n", layer.Digest)
+		diffID, err := applyLayer(ctx, rawSource, layer, cache, destDir, tarOptions)
+		if err != nil {
+			return err
+		}
+		if diffIDs != nil && diffID != diffIDs[i] {
+			return fmt.Errorf("Layer %s has diffID %s, but the configuration expects %s", layer.Digest, diffID, diffIDs[i])
+		}
+	}
+	return nil
+}
+
+// checkExtractDestination returns an error if dir exists and is not an empty directory.
+func checkExtractDestination(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(entries) != 0 {
+		return fmt.Errorf("Destination directory %s is not empty", dir)
+	}
+	return nil
+}
+
+// applyLayer applies the layer described by info from src to destDir, and returns the digest of the uncompressed layer.
+func applyLayer(ctx context.Context, src types.ImageSource, info types.BlobInfo, cache types.BlobInfoCache, destDir string, tarOptions *archive.TarOptions) (digest.Digest, error) {
+	blob, _, err := src.GetBlob(ctx, info, cache)
+	if err != nil {
+		return "", fmt.Errorf("Error reading layer %s: %v", info.Digest, err)
+	}
+	defer blob.Close()
+	stream, _, err := compression.AutoDecompress(blob)
+	if err != nil {
+		return "", fmt.Errorf("Error decompressing layer %s: %v", info.Digest, err)
+	}
+	defer stream.Close()
+
+	digester := digest.Canonical.Digester()
+	uncompressed := io.TeeReader(stream, digester.Hash())
+	// Apply the layer in a chroot, so that symbolic links in the layer can't be used to write outside of destDir.
+	if _, err := chrootarchive.ApplyUncompressedLayer(destDir, uncompressed, tarOptions); err != nil {
+		return "", fmt.Errorf("Error applying layer %s: %v", info.Digest, err)
+	}
+	// Include any padding after the end of the tar archive in the digest.
+	if _, err := io.Copy(ioutil.Discard, uncompressed); err != nil {
+		return "", fmt.Errorf("Error reading layer %s: %v", info.Digest, err)
+	}
+	return digester.Digest(), nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtract(t *testing.T) {
+	registry := newFakeRegistry()
+	defer registry.Close()
+	config := map[string]interface{}{"architecture": "amd64", "os": "linux", "created": time.Now().UTC().Format(time.RFC3339Nano)}
+
+	base, baseDiffID, _ := registry.addLayer(t, []fakeFile{
+		{name: "etc/", typeflag: tar.TypeDir},
+		{name: "etc/config", contents: "v1"},
+		{name: "etc/removed", contents: "x"},
+		{name: "data/", typeflag: tar.TypeDir},
+		{name: "data/old", contents: "old"},
+		{name: "home/", typeflag: tar.TypeDir},
+		{name: "home/user", contents: "owned", uid: 1000, gid: 100},
+	})
+	app, appDiffID, _ := registry.addLayer(t, []fakeFile{
+		{name: "etc/config", contents: "v2"},
+		{name: "etc/.wh.removed"},
+		{name: "data/.wh..wh..opq"},
+		{name: "data/new", contents: "new"},
+		{name: "config-link", typeflag: tar.TypeSymlink, linkname: "etc/config"},
+	})
+	registry.addImageWithLayers(t, "app", config, []digest.Digest{base, app}, []digest.Digest{baseDiffID, appDiffID}, "latest")
+	registry.addImageWithLayers(t, "app", config, []digest.Digest{base, app}, []digest.Digest{baseDiffID, baseDiffID}, "bad-diffids")
+	image := "docker://" + registry.host() + "/app:latest"
+
+	tmpDir, err := ioutil.TempDir("", "skopeo-extract")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	dest := filepath.Join(tmpDir, "rootfs")
+	out, err := runSkopeo("extract", "--tls-verify=false", "--verify-diffids", image, dest)
+	require.NoError(t, err)
+	assert.Equal(t, "Applying layer "+base.String()+"\nApplying layer "+app.String()+"\n", out)
+	files := []string{}
+	err = filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dest, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(files)
+	assert.Equal(t, []string{".", "config-link", "data", "data/new", "etc", "etc/config", "home", "home/user"}, files)
+	contents, err := ioutil.ReadFile(filepath.Join(dest, "config-link"))
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(contents))
+
+	if os.Geteuid() == 0 {
+		fi, err := os.Lstat(filepath.Join(dest, "home/user"))
+		require.NoError(t, err)
+		st := fi.Sys().(*syscall.Stat_t)
+		assert.Equal(t, []uint32{1000, 100}, []uint32{st.Uid, st.Gid})
+
+		mapped := filepath.Join(tmpDir, "mapped")
+		_, err = runSkopeo("extract", "--tls-verify=false", "--uidmap", "0:100000:65536", "--gidmap", "0:200000:65536", image, mapped)
+		require.NoError(t, err)
+		fi, err = os.Lstat(filepath.Join(mapped, "home/user"))
+		require.NoError(t, err)
+		st = fi.Sys().(*syscall.Stat_t)
+		assert.Equal(t, []uint32{101000, 200100}, []uint32{st.Uid, st.Gid})
+		fi, err = os.Lstat(filepath.Join(mapped, "etc/config"))
+		require.NoError(t, err)
+		st = fi.Sys().(*syscall.Stat_t)
+		assert.Equal(t, []uint32{100000, 200000}, []uint32{st.Uid, st.Gid})
+	}
+
+	// diffID verification
+	_, err = runSkopeo("extract", "--tls-verify=false", "--verify-diffids", "docker://"+registry.host()+"/app:bad-diffids", filepath.Join(tmpDir, "bad"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Layer "+app.String()+" has diffID "+appDiffID.String())
+	_, err = runSkopeo("extract", "--tls-verify=false", "docker://"+registry.host()+"/app:bad-diffids", filepath.Join(tmpDir, "unverified"))
+	require.NoError(t, err)
+
+	// A symbolic link in a layer must not allow writing outside of the destination.
+	outside := filepath.Join(tmpDir, "outside")
+	err = os.Mkdir(outside, 0755)
+	require.NoError(t, err)
+	escape, escapeDiffID, _ := registry.addLayer(t, []fakeFile{
+		{name: "esc", typeflag: tar.TypeSymlink, linkname: outside},
+		{name: "esc/pwned", contents: "pwned"},
+	})
+	registry.addImageWithLayers(t, "app", config, []digest.Digest{escape}, []digest.Digest{escapeDiffID}, "escape")
+	_, err = runSkopeo("extract", "--tls-verify=false", "docker://"+registry.host()+"/app:escape", filepath.Join(tmpDir, "escape"))
+	if err == nil {
+		contents, err := ioutil.ReadFile(filepath.Join(tmpDir, "escape", outside, "pwned"))
+		require.NoError(t, err)
+		assert.Equal(t, "pwned", string(contents))
+	}
+	entries, err := ioutil.ReadDir(outside)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Invalid arguments
+	out, err = runSkopeo("extract", "--tls-verify=false", image)
+	assertTestFailed(t, out, err, "Usage")
+	out, err = runSkopeo("extract", "--tls-verify=false", image, dest)
+	assertTestFailed(t, out, err, "is not empty")
+	out, err = runSkopeo("extract", "--tls-verify=false", "--uidmap", "0:1000", image, filepath.Join(tmpDir, "invalid"))
+	assertTestFailed(t, out, err, "malformed")
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containers/image/manifest"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistry is a plain-HTTP registry implementing the subset of the Docker Registry HTTP API V2 used by tests,
+// storing everything in memory.
+type fakeRegistry struct {
+	*httptest.Server
+	mu        sync.Mutex
+	blobs     map[digest.Digest][]byte
+	blobRepos map[digest.Digest]map[string]bool // Repositories containing a blob; blobs added by addBlob are in all repositories
+	uploads   map[string][]byte                 // Upload ID → data uploaded so far
+	manifests map[digest.Digest]fakeManifest
+	tags      map[string]map[string]digest.Digest // repository → tag → manifest digest
+	requests  []string                            // "METHOD path" of requests received, excluding /v2/
+	// tagDeletionStatus is the response status to DELETE /v2/<name>/manifests/<tag>; the tag is only deleted with a 2xx status.
+	// 0, the default, means http.StatusBadRequest with an UNSUPPORTED error.  Set it before making any requests.
+	tagDeletionStatus int
+}
+
+// fakeManifest is a manifest stored in fakeRegistry.
+type fakeManifest struct {
+	mimeType string
+	body     []byte
+}
+
+var fakeRegistryPathRegexp = regexp.MustCompile(`^/v2/(.+)/(manifests|blobs|tags)/(.+)$`)
+
+// newFakeRegistry returns a running fakeRegistry.  The caller must call Close.
+func newFakeRegistry() *fakeRegistry {
+	r := &fakeRegistry{
+		blobs:     map[digest.Digest][]byte{},
+		blobRepos: map[digest.Digest]map[string]bool{},
+		uploads:   map[string][]byte{},
+		manifests: map[digest.Digest]fakeManifest{},
+		tags:      map[string]map[string]digest.Digest{},
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	return r
+}
+
+// host returns the host:port of r, for use in image references.
+func (r *fakeRegistry) host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+func (r *fakeRegistry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if req.URL.Path == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+	m := fakeRegistryPathRegexp.FindStringSubmatch(req.URL.Path)
+	if m == nil {
+		http.NotFound(w, req)
+		return
+	}
+	repo, kind, ref := m[1], m[2], m[3]
+	switch {
+	case kind == "tags" && ref == "list" && req.Method == http.MethodGet:
+		tags := []string{}
+		for tag := range r.tags[repo] {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": repo, "tags": tags})
+
+	case kind == "blobs" && ref == "uploads/" && req.Method == http.MethodPost:
+		query := req.URL.Query()
+		if mount := digest.Digest(query.Get("mount")); mount != "" && r.hasBlob(query.Get("from"), mount) {
+			r.addBlobToRepo(repo, mount)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		id := fmt.Sprintf("%d", len(r.uploads)+1)
+		r.uploads[id] = []byte{}
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, id))
+		w.WriteHeader(http.StatusAccepted)
+
+	case kind == "blobs" && strings.HasPrefix(ref, "uploads/"):
+		id := strings.TrimPrefix(ref, "uploads/")
+		data, ok := r.uploads[id]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		switch req.Method {
+		case http.MethodPatch:
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			r.uploads[id] = append(data, body...)
+			w.Header().Set("Location", req.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodPut:
+			d := digest.Digest(req.URL.Query().Get("digest"))
+			if d != digest.FromBytes(data) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			delete(r.uploads, id)
+			r.blobs[d] = data
+			r.addBlobToRepo(repo, d)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			delete(r.uploads, id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+
+	case kind == "blobs" && (req.Method == http.MethodGet || req.Method == http.MethodHead):
+		blob, ok := r.blobs[digest.Digest(ref)]
+		if !ok || !r.hasBlob(repo, digest.Digest(ref)) {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(blob)))
+		w.Header().Set("Docker-Content-Digest", ref)
+		if req.Method == http.MethodGet {
+			w.Write(blob)
+		}
+
+	case kind == "manifests" && (req.Method == http.MethodGet || req.Method == http.MethodHead):
+		d, ok := r.resolve(repo, ref)
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		man := r.manifests[d]
+		w.Header().Set("Content-Type", man.mimeType)
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(man.body)))
+		w.Header().Set("Docker-Content-Digest", d.String())
+		if req.Method == http.MethodGet {
+			w.Write(man.body)
+		}
+
+	case kind == "manifests" && req.Method == http.MethodPut:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		d := digest.FromBytes(body)
+		if expected, err := digest.Parse(ref); err == nil && expected != d {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.manifests[d] = fakeManifest{mimeType: req.Header.Get("Content-Type"), body: body}
+		if _, err := digest.Parse(ref); err != nil {
+			if r.tags[repo] == nil {
+				r.tags[repo] = map[string]digest.Digest{}
+			}
+			r.tags[repo][ref] = d
+		}
+		w.Header().Set("Docker-Content-Digest", d.String())
+		w.WriteHeader(http.StatusCreated)
+
+	case kind == "manifests" && req.Method == http.MethodDelete:
+		d, err := digest.Parse(ref)
+		if err != nil {
+			if _, ok := r.tags[repo][ref]; !ok {
+				http.NotFound(w, req)
+				return
+			}
+			switch status := r.tagDeletionStatus; {
+			case status == 0 || status == http.StatusBadRequest:
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors":[{"code":"UNSUPPORTED","message":"The operation is unsupported."}]}`))
+			case status >= 200 && status <= 299:
+				delete(r.tags[repo], ref)
+				w.WriteHeader(status)
+			default:
+				w.WriteHeader(status)
+			}
+			return
+		}
+		if _, ok := r.manifests[d]; !ok {
+			http.NotFound(w, req)
+			return
+		}
+		delete(r.manifests, d)
+		for tag, tagDigest := range r.tags[repo] {
+			if tagDigest == d {
+				delete(r.tags[repo], tag)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// hasBlob returns true if repo contains the blob with d.  The caller must hold r.mu.
+func (r *fakeRegistry) hasBlob(repo string, d digest.Digest) bool {
+	if _, ok := r.blobs[d]; !ok {
+		return false
+	}
+	repos, ok := r.blobRepos[d]
+	return !ok || repos[repo]
+}
+
+// addBlobToRepo records that repo contains the blob with d.  The caller must hold r.mu.
+func (r *fakeRegistry) addBlobToRepo(repo string, d digest.Digest) {
+	if r.blobRepos[d] == nil {
+		r.blobRepos[d] = map[string]bool{}
+	}
+	r.blobRepos[d][repo] = true
+}
+
+// resolve returns the canonical manifest digest for a tag or digest in repo, if it exists.
+func (r *fakeRegistry) resolve(repo, tagOrDigest string) (digest.Digest, bool) {
+	d, err := digest.Parse(tagOrDigest)
+	if err != nil {
+		d, ok := r.tags[repo][tagOrDigest]
+		return d, ok
+	}
+	if d.Algorithm() != digest.Canonical {
+		for canonical, man := range r.manifests {
+			if d.Algorithm().FromBytes(man.body) == d {
+				return canonical, true
+			}
+		}
+		return "", false
+	}
+	_, ok := r.manifests[d]
+	return d, ok
+}
+
+// addBlob stores blob, and returns its digest.
+func (r *fakeRegistry) addBlob(blob []byte) digest.Digest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := digest.FromBytes(blob)
+	r.blobs[d] = blob
+	return d
+}
+
+// addManifest stores a manifest of mimeType, tags it in repo with tags, and returns its digest.
+func (r *fakeRegistry) addManifest(repo string, mimeType string, body []byte, tags ...string) digest.Digest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := digest.FromBytes(body)
+	r.manifests[d] = fakeManifest{mimeType: mimeType, body: body}
+	if r.tags[repo] == nil {
+		r.tags[repo] = map[string]digest.Digest{}
+	}
+	for _, tag := range tags {
+		r.tags[repo][tag] = d
+	}
+	return d
+}
+
+// tagsOf returns the sorted tags in repo.
+func (r *fakeRegistry) tagsOf(repo string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tags := []string{}
+	for tag := range r.tags[repo] {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// fakeImage describes an image created by fakeRegistry.addImage.
+type fakeImage struct {
+	digest    digest.Digest // Of the manifest
+	config    digest.Digest
+	layer     digest.Digest // Of the compressed layer
+	diffID    digest.Digest
+	layerBlob []byte // The compressed layer
+}
+
+// addImage creates a single-layer Docker schema2 image with a config created at created for os/arch,
+// containing a single file with contents, tags it in repo with tags, and returns it.
+func (r *fakeRegistry) addImage(t *testing.T, repo string, created time.Time, os, arch, contents string, tags ...string) fakeImage {
+	layer, diffID, layerBlob := r.addLayer(t, []fakeFile{{name: "file", contents: contents, modTime: created}})
+	config := map[string]interface{}{
+		"created":      created.UTC().Format(time.RFC3339Nano),
+		"architecture": arch,
+		"os":           os,
+		"config":       map[string]interface{}{"Cmd": []string{"/bin/sh"}},
+		"history":      []map[string]interface{}{{"created": created.UTC().Format(time.RFC3339Nano), "created_by": "ADD file /"}},
+	}
+	d, configDigest := r.addImageWithLayers(t, repo, config, []digest.Digest{layer}, []digest.Digest{diffID}, tags...)
+	return fakeImage{digest: d, config: configDigest, layer: layer, diffID: diffID, layerBlob: layerBlob}
+}
+
+// fakeFile is a file in a layer created by fakeRegistry.addLayer.
+type fakeFile struct {
+	name     string
+	contents string
+	typeflag byte // tar.TypeReg if 0
+	linkname string
+	modTime  time.Time
+	uid, gid int
+}
+
+// addLayer creates a gzip-compressed layer containing files, and returns its digest, diffID and contents.
+func (r *fakeRegistry) addLayer(t *testing.T, files []fakeFile) (digest.Digest, digest.Digest, []byte) {
+	tarBuf := bytes.Buffer{}
+	tw := tar.NewWriter(&tarBuf)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Typeflag: f.typeflag, Linkname: f.linkname, ModTime: f.modTime, Uid: f.uid, Gid: f.gid}
+		switch f.typeflag {
+		case 0:
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(f.contents))
+		case tar.TypeDir:
+			hdr.Mode = 0755
+		}
+		err := tw.WriteHeader(hdr)
+		require.NoError(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			_, err = tw.Write([]byte(f.contents))
+			require.NoError(t, err)
+		}
+	}
+	err := tw.Close()
+	require.NoError(t, err)
+	diffID := digest.FromBytes(tarBuf.Bytes())
+	gzBuf := bytes.Buffer{}
+	gzw := gzip.NewWriter(&gzBuf)
+	_, err = gzw.Write(tarBuf.Bytes())
+	require.NoError(t, err)
+	err = gzw.Close()
+	require.NoError(t, err)
+	return r.addBlob(gzBuf.Bytes()), diffID, gzBuf.Bytes()
+}
+
+// addImageWithLayers creates a Docker schema2 image with config, to which rootfs is added, and layers created by addLayer,
+// tags it in repo with tags, and returns the digests of its manifest and config.
+func (r *fakeRegistry) addImageWithLayers(t *testing.T, repo string, config map[string]interface{}, layers, diffIDs []digest.Digest, tags ...string) (digest.Digest, digest.Digest) {
+	config["rootfs"] = map[string]interface{}{"type": "layers", "diff_ids": diffIDs}
+	configBlob, err := json.Marshal(config)
+	require.NoError(t, err)
+	configDigest := r.addBlob(configBlob)
+
+	layerDescriptors := []map[string]interface{}{}
+	for _, layer := range layers {
+		r.mu.Lock()
+		size := len(r.blobs[layer])
+		r.mu.Unlock()
+		layerDescriptors = append(layerDescriptors, map[string]interface{}{
+			"mediaType": manifest.DockerV2Schema2LayerMediaType,
+			"size":      size,
+			"digest":    layer.String(),
+		})
+	}
+	man, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     manifest.DockerV2Schema2MediaType,
+		"config": map[string]interface{}{
+			"mediaType": manifest.DockerV2Schema2ConfigMediaType,
+			"size":      len(configBlob),
+			"digest":    configDigest.String(),
+		},
+		"layers": layerDescriptors,
+	})
+	require.NoError(t, err)
+	return r.addManifest(repo, manifest.DockerV2Schema2MediaType, man, tags...), configDigest
+}
+
+// addList creates a manifest list of mimeType (a Docker manifest list or an OCI image index) containing images,
+// for the corresponding platforms in the os/arch[/variant] format, tags it in repo with tags, and returns its digest.
+func (r *fakeRegistry) addList(t *testing.T, repo string, mimeType string, images []fakeImage, platforms []string, tags ...string) digest.Digest {
+	require.Len(t, platforms, len(images))
+	manifests := []map[string]interface{}{}
+	for i, img := range images {
+		platform, err := parsePlatform(platforms[i])
+		require.NoError(t, err)
+		r.mu.Lock()
+		man := r.manifests[img.digest]
+		r.mu.Unlock()
+		manifests = append(manifests, map[string]interface{}{
+			"mediaType": man.mimeType,
+			"size":      len(man.body),
+			"digest":    img.digest.String(),
+			"platform":  map[string]string{"os": platform.OS, "architecture": platform.Architecture, "variant": platform.Variant},
+		})
+	}
+	contents := map[string]interface{}{"schemaVersion": 2, "manifests": manifests}
+	if mimeType == manifest.DockerV2ListMediaType {
+		contents["mediaType"] = mimeType
+	}
+	list, err := json.Marshal(contents)
+	require.NoError(t, err)
+	return r.addManifest(repo, mimeType, list, tags...)
+}
+
+// readAllRequests returns the requests received so far, and forgets them.
+func (r *fakeRegistry) readAllRequests() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.requests
+	r.requests = nil
+	return res
+}
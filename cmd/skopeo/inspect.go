@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/containers/image/docker"
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/image"
 	"github.com/containers/image/manifest"
 	"github.com/containers/image/transports"
+	"github.com/containers/image/types"
 	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -28,13 +34,51 @@ type inspectOutput struct {
 	Architecture  string
 	Os            string
 	Layers        []string
+	MediaType     string           // Of the manifest
+	LayersData    []inspectLayer   // Corresponds to Layers
+	LayersSize    int64            // The total compressed size of layers, -1 if unknown
+	Env           []string         // Environment variables set by the configuration
+	Cmd           []string         // Default arguments of the entrypoint
+	Entrypoint    []string         // Command to run in a container
+	ExposedPorts  []string         // Ports exposed by the configuration, sorted
+	User          string           // User the container processes run as
+	History       []inspectHistory // How the image was built
+}
+
+// inspectLayer describes a layer in inspectOutput.
+type inspectLayer struct {
+	Digest    digest.Digest
+	Size      int64 // Compressed; -1 if unknown
+	MediaType string
+}
+
+// inspectHistory describes a history entry in inspectOutput.
+type inspectHistory struct {
+	Created    *time.Time `json:",omitempty"`
+	CreatedBy  string     `json:",omitempty"`
+	Author     string     `json:",omitempty"`
+	Comment    string     `json:",omitempty"`
+	EmptyLayer bool       `json:",omitempty"`
+}
+
+// inspectListOutput is the output format of (skopeo inspect) for manifest lists and OCI image indexes.
+type inspectListOutput struct {
+	Name      string `json:",omitempty"`
+	Tag       string `json:",omitempty"`
+	Digest    digest.Digest
+	MediaType string
+	RepoTags  []string
+	Manifests []listInstance
 }
 
 type inspectOptions struct {
-	global *globalOptions
-	image  *imageOptions
-	raw    bool // Output the raw manifest instead of parsing information about the image
-	config bool // Output the raw config blob instead of parsing information about the image
+	global   *globalOptions
+	image    *imageOptions
+	raw      bool   // Output the raw manifest instead of parsing information about the image
+	config   bool   // Output the raw config blob instead of parsing information about the image
+	platform string // Inspect the image for this os/arch[/variant] in a manifest list
+	instance string // Inspect the image with this digest in a manifest list
+	format   string // Format the output using this Go template
 }
 
 func inspectCmd(global *globalOptions) cli.Command {
@@ -53,6 +97,11 @@ func inspectCmd(global *globalOptions) cli.Command {
 	Supported transports:
 	%s
 
+	If "IMAGE-NAME" is a manifest list or an OCI image index, the images it contains are listed;
+	use --platform or --instance to inspect one of them
+
+	With --format, the output is formatted using a Go template, e.g. --format '{{.Digest}}'
+
 	See skopeo(1) section "IMAGE NAMES" for the expected format
 	`, strings.Join(transports.ListNames(), ", ")),
 		ArgsUsage: "IMAGE-NAME",
@@ -67,6 +116,21 @@ func inspectCmd(global *globalOptions) cli.Command {
 				Usage:       "output configuration",
 				Destination: &opts.config,
 			},
+			cli.StringFlag{
+				Name:        "platform",
+				Usage:       "inspect the image for `OS/ARCH[/VARIANT]` in a manifest list",
+				Destination: &opts.platform,
+			},
+			cli.StringFlag{
+				Name:        "instance",
+				Usage:       "inspect the image with `DIGEST` in a manifest list",
+				Destination: &opts.instance,
+			},
+			cli.StringFlag{
+				Name:        "format",
+				Usage:       "format the output using the Go `TEMPLATE`",
+				Destination: &opts.format,
+			},
 		}, sharedFlags...), imageFlags...),
 		Action: commandAction(opts.run),
 	}
@@ -80,23 +144,95 @@ func (opts *inspectOptions) run(args []string, stdout io.Writer) (retErr error)
 		return errors.New("Exactly one argument expected")
 	}
 	imageName := args[0]
+	if opts.platform != "" && opts.instance != "" {
+		return errors.New("--platform and --instance can not be used together")
+	}
+	var tmpl *template.Template
+	if opts.format != "" {
+		if opts.raw || opts.config {
+			return errors.New("--format can not be used together with --raw or --config")
+		}
+		t, err := template.New("format").Parse(opts.format)
+		if err != nil {
+			return fmt.Errorf("Invalid --format template: %v", err)
+		}
+		tmpl = t
+	}
 
 	if err := reexecIfNecessaryForImages(imageName); err != nil {
 		return err
 	}
 
-	img, err := parseImage(ctx, opts.image, imageName)
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+	ref, err := parseSourceImageName(ctx, sys, imageName)
+	if err != nil {
+		return err
+	}
+	src, err := ref.NewImageSource(ctx, sys)
 	if err != nil {
 		return err
 	}
 
 	defer func() {
-		if err := img.Close(); err != nil {
-			retErr = errors.Wrapf(retErr, fmt.Sprintf("(could not close image: %v) ", err))
+		if err := src.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, "(could not close image: %v) ", err)
 		}
 	}()
 
-	rawManifest, _, err := img.Manifest(ctx)
+	topManifest, topMIMEType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var instanceDigest *digest.Digest
+	if isManifestList(topMIMEType) {
+		if opts.raw && !opts.config && opts.platform == "" && opts.instance == "" {
+			if _, err := stdout.Write(topManifest); err != nil {
+				return fmt.Errorf("Error writing manifest to standard output: %v", err)
+			}
+			return nil
+		}
+		instances, err := parseManifestList(topManifest, topMIMEType)
+		if err != nil {
+			return err
+		}
+		var chosen digest.Digest
+		switch {
+		case opts.instance != "":
+			chosen, err = digest.Parse(opts.instance)
+			if err != nil {
+				return fmt.Errorf("Invalid instance digest %s: %v", opts.instance, err)
+			}
+			if err := findListInstance(instances, chosen); err != nil {
+				return err
+			}
+		case opts.platform != "":
+			platform, err := parsePlatform(opts.platform)
+			if err != nil {
+				return err
+			}
+			if chosen, err = chooseListInstance(instances, platform); err != nil {
+				return err
+			}
+		case opts.config:
+			if chosen, err = chooseListInstance(instances, defaultPlatform(sys)); err != nil {
+				return err
+			}
+		default:
+			return writeListOutput(ctx, sys, ref, topManifest, topMIMEType, instances, tmpl, stdout)
+		}
+		instanceDigest = &chosen
+	} else if opts.platform != "" || opts.instance != "" {
+		return fmt.Errorf("--platform and --instance can only be used with manifest lists, %s is not a manifest list", imageName)
+	}
+
+	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, instanceDigest))
+	if err != nil {
+		return err
+	}
+	rawManifest, manifestMIMEType, err := img.Manifest(ctx)
 	if err != nil {
 		return err
 	}
@@ -142,6 +278,10 @@ func (opts *inspectOptions) run(args []string, stdout io.Writer) (retErr error)
 		Architecture:  imgInspect.Architecture,
 		Os:            imgInspect.Os,
 		Layers:        imgInspect.Layers,
+		MediaType:     manifestMIMEType,
+		LayersData:    []inspectLayer{},
+		LayersSize:    0, // Set below
+		// Env, Cmd, Entrypoint, ExposedPorts, User and History are set below.
 	}
 	outputData.Digest, err = manifest.Digest(rawManifest)
 	if err != nil {
@@ -150,21 +290,79 @@ func (opts *inspectOptions) run(args []string, stdout io.Writer) (retErr error)
 	if dockerRef := img.Reference().DockerReference(); dockerRef != nil {
 		outputData.Name = dockerRef.Name()
 	}
-	if img.Reference().Transport() == docker.Transport {
-		sys, err := opts.image.newSystemContext()
-		if err != nil {
-			return err
+	for _, layer := range img.LayerInfos() {
+		outputData.LayersData = append(outputData.LayersData, inspectLayer{Digest: layer.Digest, Size: layer.Size, MediaType: layer.MediaType})
+		if layer.Size < 0 || outputData.LayersSize < 0 {
+			outputData.LayersSize = -1
+		} else {
+			outputData.LayersSize += layer.Size
 		}
-		outputData.RepoTags, err = docker.GetRepositoryTags(ctx, sys, img.Reference())
-		if err != nil {
-			// some registries may decide to block the "list all tags" endpoint
-			// gracefully allow the inspect to continue in this case. Currently
-			// the IBM Bluemix container registry has this restriction.
-			if !strings.Contains(err.Error(), "401") {
-				return fmt.Errorf("Error determining repository tags: %v", err)
-			}
-			logrus.Warnf("Registry disallows tag list retrieval; skipping")
+	}
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("Error reading OCI-formatted configuration data: %v", err)
+	}
+	outputData.Env = config.Config.Env
+	outputData.Cmd = config.Config.Cmd
+	outputData.Entrypoint = config.Config.Entrypoint
+	outputData.ExposedPorts = []string{}
+	for port := range config.Config.ExposedPorts {
+		outputData.ExposedPorts = append(outputData.ExposedPorts, port)
+	}
+	sort.Strings(outputData.ExposedPorts)
+	outputData.User = config.Config.User
+	outputData.History = []inspectHistory{}
+	for _, h := range config.History {
+		outputData.History = append(outputData.History, inspectHistory{
+			Created:    h.Created,
+			CreatedBy:  h.CreatedBy,
+			Author:     h.Author,
+			Comment:    h.Comment,
+			EmptyLayer: h.EmptyLayer,
+		})
+	}
+	if outputData.RepoTags, err = repositoryTags(ctx, sys, img.Reference()); err != nil {
+		return err
+	}
+	return writeInspectOutput(outputData, tmpl, stdout)
+}
+
+// writeListOutput writes a description of a manifest list or an OCI image index with rawManifest, mimeType and instances to stdout,
+// formatted using tmpl if it is not nil.
+func writeListOutput(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, rawManifest []byte, mimeType string, instances []listInstance, tmpl *template.Template, stdout io.Writer) error {
+	outputData := inspectListOutput{
+		Name: "", // Set below if DockerReference() is known
+		Tag:  "", // Set below if DockerReference() is known
+		// Digest is set below.
+		MediaType: mimeType,
+		// RepoTags is set below.
+		Manifests: instances,
+	}
+	var err error
+	outputData.Digest, err = manifest.Digest(rawManifest)
+	if err != nil {
+		return fmt.Errorf("Error computing manifest digest: %v", err)
+	}
+	if dockerRef := ref.DockerReference(); dockerRef != nil {
+		outputData.Name = dockerRef.Name()
+		if tagged, ok := dockerRef.(reference.NamedTagged); ok {
+			outputData.Tag = tagged.Tag()
+		}
+	}
+	if outputData.RepoTags, err = repositoryTags(ctx, sys, ref); err != nil {
+		return err
+	}
+	return writeInspectOutput(outputData, tmpl, stdout)
+}
+
+// writeInspectOutput writes outputData to stdout, formatted using tmpl, or as JSON if tmpl is nil.
+func writeInspectOutput(outputData interface{}, tmpl *template.Template, stdout io.Writer) error {
+	if tmpl != nil {
+		if err := tmpl.Execute(stdout, outputData); err != nil {
+			return fmt.Errorf("Error formatting output: %v", err)
 		}
+		fmt.Fprintln(stdout)
+		return nil
 	}
 	out, err := json.MarshalIndent(outputData, "", "    ")
 	if err != nil {
@@ -173,3 +371,22 @@ func (opts *inspectOptions) run(args []string, stdout io.Writer) (retErr error)
 	fmt.Fprintf(stdout, "%s\n", string(out))
 	return nil
 }
+
+// repositoryTags returns the tags in the repository of ref, or an empty list if they are not known.
+func repositoryTags(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) ([]string, error) {
+	if ref.Transport() != docker.Transport {
+		return []string{}, nil
+	}
+	tags, err := docker.GetRepositoryTags(ctx, sys, ref)
+	if err != nil {
+		// some registries may decide to block the "list all tags" endpoint
+		// gracefully allow the inspect to continue in this case. Currently
+		// the IBM Bluemix container registry has this restriction.
+		if !strings.Contains(err.Error(), "401") {
+			return nil, fmt.Errorf("Error determining repository tags: %v", err)
+		}
+		logrus.Warnf("Registry disallows tag list retrieval; skipping")
+		return []string{}, nil
+	}
+	return tags, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containers/image/manifest"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectManifestList(t *testing.T) {
+	registry := newFakeRegistry()
+	defer registry.Close()
+	now := time.Now()
+	amd64 := registry.addImage(t, "multi", now, "linux", "amd64", "amd64")
+	arm64 := registry.addImage(t, "multi", now, "linux", "arm64", "arm64")
+	armv7 := registry.addImage(t, "multi", now, "linux", "arm", "armv7")
+	images := []fakeImage{amd64, arm64, armv7}
+	platforms := []string{"linux/amd64", "linux/arm64/v8", "linux/arm/v7"}
+	registry.addImage(t, "multi", now, "linux", "amd64", "single", "single")
+
+	for _, mimeType := range []string{manifest.DockerV2ListMediaType, imgspecv1.MediaTypeImageIndex} {
+		listDigest := registry.addList(t, "multi", mimeType, images, platforms, "list")
+		image := "docker://" + registry.host() + "/multi:list"
+
+		inspect := func(args ...string) string {
+			out, err := runSkopeo(append(append([]string{"inspect", "--tls-verify=false"}, args...), image)...)
+			require.NoError(t, err, strings.Join(args, " "))
+			return out
+		}
+
+		// The list is described
+		var list inspectListOutput
+		err := json.Unmarshal([]byte(inspect()), &list)
+		require.NoError(t, err)
+		assert.Equal(t, registry.host()+"/multi", list.Name)
+		assert.Equal(t, "list", list.Tag)
+		assert.Equal(t, listDigest, list.Digest)
+		assert.Equal(t, mimeType, list.MediaType)
+		assert.Equal(t, []string{"list", "single"}, list.RepoTags)
+		require.Len(t, list.Manifests, 3)
+		for i, instance := range list.Manifests {
+			assert.Equal(t, images[i].digest, instance.Digest)
+			assert.Equal(t, manifest.DockerV2Schema2MediaType, instance.MediaType)
+			assert.Equal(t, int64(len(registry.manifests[images[i].digest].body)), instance.Size)
+			assert.Equal(t, platforms[i], instance.Platform.String())
+		}
+
+		// --raw outputs the list itself
+		out := inspect("--raw")
+		assert.Equal(t, string(registry.manifests[listDigest].body), out)
+
+		// Choosing an image
+		for _, c := range []struct {
+			args     []string
+			expected fakeImage
+		}{
+			{[]string{"--platform", "linux/arm64"}, arm64},
+			{[]string{"--platform", "linux/arm/v7"}, armv7},
+			{[]string{"--instance", amd64.digest.String()}, amd64},
+		} {
+			var img inspectOutput
+			err := json.Unmarshal([]byte(inspect(c.args...)), &img)
+			require.NoError(t, err, strings.Join(c.args, " "))
+			assert.Equal(t, c.expected.digest, img.Digest, strings.Join(c.args, " "))
+			assert.Equal(t, []string{c.expected.layer.String()}, img.Layers, strings.Join(c.args, " "))
+		}
+		out = inspect("--platform", "linux/arm/v7", "--raw")
+		assert.Equal(t, string(registry.manifests[armv7.digest].body), out)
+
+		// Invalid arguments
+		for _, c := range []struct {
+			args     []string
+			expected string
+		}{
+			{[]string{"--platform", "linux/arm/v6"}, "No image found in manifest list for platform linux/arm/v6"},
+			{[]string{"--platform", "linux"}, "Invalid platform"},
+			{[]string{"--instance", "sha256:0000"}, "Invalid instance digest"},
+			{[]string{"--instance", digest.FromString("missing").String()}, "not found in manifest list"},
+			{[]string{"--instance", amd64.digest.String(), "--platform", "linux/amd64"}, "can not be used together"},
+		} {
+			out, err := runSkopeo(append(append([]string{"inspect", "--tls-verify=false"}, c.args...), image)...)
+			assertTestFailed(t, out, err, c.expected)
+		}
+	}
+
+	out, err := runSkopeo("inspect", "--tls-verify=false", "--platform", "linux/amd64", "docker://"+registry.host()+"/multi:single")
+	assertTestFailed(t, out, err, "is not a manifest list")
+}
+
+func TestInspectExtendedOutput(t *testing.T) {
+	registry := newFakeRegistry()
+	defer registry.Close()
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	img := registry.addImage(t, "app", created, "linux", "amd64", "contents", "latest")
+	image := "docker://" + registry.host() + "/app:latest"
+
+	out, err := runSkopeo("inspect", "--tls-verify=false", image)
+	require.NoError(t, err)
+	var res inspectOutput
+	err = json.Unmarshal([]byte(out), &res)
+	require.NoError(t, err)
+	assert.Equal(t, manifest.DockerV2Schema2MediaType, res.MediaType)
+	assert.Equal(t, []inspectLayer{{Digest: img.layer, Size: int64(len(img.layerBlob)), MediaType: manifest.DockerV2Schema2LayerMediaType}}, res.LayersData)
+	assert.Equal(t, int64(len(img.layerBlob)), res.LayersSize)
+	assert.Equal(t, []string{"/bin/sh"}, res.Cmd)
+	assert.Equal(t, []string{}, res.ExposedPorts)
+	assert.Equal(t, []inspectHistory{{Created: &created, CreatedBy: "ADD file /"}}, res.History)
+
+	// --format
+	for _, c := range []struct{ format, expected string }{
+		{"{{.Digest}}", img.digest.String()},
+		{"{{.Architecture}}/{{.Os}} {{index .Cmd 0}}", "amd64/linux /bin/sh"},
+		{"{{range .LayersData}}{{.Digest}} {{.Size}}{{end}}", fmt.Sprintf("%s %d", img.layer, len(img.layerBlob))},
+	} {
+		out, err := runSkopeo("inspect", "--tls-verify=false", "--format", c.format, image)
+		require.NoError(t, err, c.format)
+		assert.Equal(t, c.expected+"\n", out, c.format)
+	}
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--format", "{{.Digest"}, "Invalid --format template"},
+		{[]string{"--format", "{{.NoSuchField}}"}, "Error formatting output"},
+		{[]string{"--format", "{{.Digest}}", "--raw"}, "can not be used together with --raw"},
+	} {
+		out, err := runSkopeo(append(append([]string{"inspect", "--tls-verify=false"}, c.args...), image)...)
+		assertTestFailed(t, out, err, c.expected)
+	}
+}
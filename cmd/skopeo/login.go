@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/containers/image/docker"
+	"github.com/containers/image/pkg/docker/config"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+type loginOptions struct {
+	global        *globalOptions
+	image         *imageOptions
+	username      string // Log in as this user
+	password      string // Log in using this password
+	passwordStdin bool   // Read the password from stdin
+	getLogin      bool   // Only print the user name logged into the registry
+	list          bool   // Only list the registries with stored credentials
+}
+
+func loginCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	opts := loginOptions{
+		global: global,
+		image: &imageOptions{
+			global: global,
+			shared: sharedOpts,
+		},
+	}
+	return cli.Command{
+		Name:  "login",
+		Usage: "Log in to a container registry",
+		Description: `
+	Check that the credentials are accepted by "REGISTRY", and store them in the authentication file,
+	or using the credential helper configured for "REGISTRY" in that file
+	`,
+		ArgsUsage: "REGISTRY",
+		Action:    commandAction(opts.run),
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "username, u",
+				Usage:       "Log in as `USERNAME`",
+				Destination: &opts.username,
+			},
+			cli.StringFlag{
+				Name:        "password, p",
+				Usage:       "Log in using `PASSWORD`",
+				Destination: &opts.password,
+			},
+			cli.BoolFlag{
+				Name:        "password-stdin",
+				Usage:       "Read the password from standard input",
+				Destination: &opts.passwordStdin,
+			},
+			cli.BoolFlag{
+				Name:        "get-login",
+				Usage:       "Print the user name logged into REGISTRY, instead of logging in",
+				Destination: &opts.getLogin,
+			},
+			cli.BoolFlag{
+				Name:        "list",
+				Usage:       "List the registries with stored credentials and their user names, instead of logging in",
+				Destination: &opts.list,
+			},
+			cli.StringFlag{
+				Name:        "cert-dir",
+				Usage:       "use certificates at `PATH` (*.crt, *.cert, *.key) to connect to the registry",
+				Destination: &opts.image.dockerCertPath,
+			},
+			cli.GenericFlag{
+				Name:  "tls-verify",
+				Usage: "require HTTPS and verify certificates when talking to the container registry (defaults to true)",
+				Value: newOptionalBoolValue(&opts.image.tlsVerify),
+			},
+		}, sharedFlags...),
+	}
+}
+
+func (opts *loginOptions) run(args []string, stdout io.Writer) error {
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+
+	if opts.list {
+		if len(args) != 0 {
+			return errors.New("Usage: skopeo login --list")
+		}
+		creds, err := config.GetAllCredentials(sys)
+		if err != nil {
+			return err
+		}
+		registries := make([]string, 0, len(creds))
+		for registry := range creds {
+			registries = append(registries, registry)
+		}
+		sort.Strings(registries)
+		for _, registry := range registries {
+			fmt.Fprintf(stdout, "%s: %s\n", registry, creds[registry].Username)
+		}
+		return nil
+	}
+
+	if len(args) != 1 {
+		return errors.New("Usage: skopeo login [--username USERNAME] [--password PASSWORD | --password-stdin] REGISTRY")
+	}
+	registry := strings.TrimSuffix(args[0], "/")
+
+	if opts.getLogin {
+		username, _, err := config.GetAuthentication(sys, registry)
+		if err != nil {
+			return err
+		}
+		if username == "" {
+			return fmt.Errorf("Not logged into %s", registry)
+		}
+		fmt.Fprintln(stdout, username)
+		return nil
+	}
+
+	// Fail early if the credentials can't be stored.
+	helper, err := config.CredentialHelper(sys, registry)
+	if err != nil {
+		return err
+	}
+
+	username, password, err := opts.credentials(stdout)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+	if err := docker.CheckAuth(ctx, sys, username, password, registry); err != nil {
+		return fmt.Errorf("Error logging into %s: %v", registry, err)
+	}
+	if err := config.SetAuthentication(sys, registry, username, password); err != nil {
+		return fmt.Errorf("Error storing credentials for %s: %v", registry, err)
+	}
+	if helper != "" {
+		fmt.Fprintf(stdout, "Credentials stored using credential helper %s\n", helper)
+	}
+	fmt.Fprintln(stdout, "Login Succeeded!")
+	return nil
+}
+
+// credentials returns the user name and password to log in with, reading them from stdin if necessary.
+func (opts *loginOptions) credentials(stdout io.Writer) (string, string, error) {
+	username, password := opts.username, opts.password
+	if opts.passwordStdin {
+		if password != "" {
+			return "", "", errors.New("--password and --password-stdin can not be used together")
+		}
+		if username == "" {
+			return "", "", errors.New("--password-stdin requires --username")
+		}
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return "", "", fmt.Errorf("Error reading password: %v", err)
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if username != "" && password != "" {
+		return username, password, nil
+	}
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return "", "", errors.New("Username and password must be specified using --username and --password or --password-stdin")
+	}
+	if username == "" {
+		fmt.Fprint(stdout, "Username: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return "", "", fmt.Errorf("Error reading user name: %v", err)
+		}
+		username = strings.TrimSpace(line)
+	}
+	if password == "" {
+		fmt.Fprint(stdout, "Password: ")
+		pass, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(stdout)
+		if err != nil {
+			return "", "", fmt.Errorf("Error reading password: %v", err)
+		}
+		password = string(pass)
+	}
+	if username == "" || password == "" {
+		return "", "", errors.New("Username and password must not be empty")
+	}
+	return username, password, nil
+}
+
+type logoutOptions struct {
+	global *globalOptions
+	image  *imageOptions
+	all    bool // Remove the credentials for all registries
+}
+
+func logoutCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	opts := logoutOptions{
+		global: global,
+		image: &imageOptions{
+			global: global,
+			shared: sharedOpts,
+		},
+	}
+	return cli.Command{
+		Name:  "logout",
+		Usage: "Log out of a container registry",
+		Description: `
+	Remove the credentials for "REGISTRY" from the authentication file,
+	or from the credential helper configured for "REGISTRY" in that file
+	`,
+		ArgsUsage: "REGISTRY",
+		Action:    commandAction(opts.run),
+		Flags: append([]cli.Flag{
+			cli.BoolFlag{
+				Name:        "all, a",
+				Usage:       "Remove the credentials for all registries",
+				Destination: &opts.all,
+			},
+		}, sharedFlags...),
+	}
+}
+
+func (opts *logoutOptions) run(args []string, stdout io.Writer) error {
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+
+	if opts.all {
+		if len(args) != 0 {
+			return errors.New("Usage: skopeo logout --all")
+		}
+		if err := config.RemoveAllAuthentication(sys); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, "Removed login credentials for all registries")
+		return nil
+	}
+
+	if len(args) != 1 {
+		return errors.New("Usage: skopeo logout REGISTRY")
+	}
+	registry := strings.TrimSuffix(args[0], "/")
+
+	if _, err := config.CredentialHelper(sys, registry); err != nil {
+		return err
+	}
+	if err := config.RemoveAuthentication(sys, registry); err != nil {
+		if errors.Cause(err) == config.ErrNotLoggedIn {
+			return fmt.Errorf("Not logged into %s", registry)
+		}
+		return err
+	}
+	fmt.Fprintf(stdout, "Removed login credentials for %s\n", registry)
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setEnv sets the environment variable name to value, and returns a function which restores the original value.
+func setEnv(name, value string) func() {
+	oldValue, wasSet := os.LookupEnv(name)
+	os.Setenv(name, value)
+	return func() {
+		if wasSet {
+			os.Setenv(name, oldValue)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestLoginLogout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	dir, err := ioutil.TempDir("", "skopeo-login")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	helperDir := filepath.Join(dir, "helper")
+	err = os.Mkdir(helperDir, 0700)
+	require.NoError(t, err)
+	helperPath, err := filepath.Abs("fixtures/credential-helper")
+	require.NoError(t, err)
+	defer setEnv("PATH", helperPath+string(os.PathListSeparator)+os.Getenv("PATH"))()
+	defer setEnv("FAKE_CREDENTIAL_HELPER_DIR", helperDir)()
+	defer setEnv("HOME", dir)() // Don't use the user's .docker/config.json
+	authFile := filepath.Join(dir, "auth.json")
+	helperFile := filepath.Join(helperDir, strings.Replace(registry, ":", "_", -1))
+
+	writeAuthFile := func(contents string) {
+		err := ioutil.WriteFile(authFile, []byte(contents), 0600)
+		require.NoError(t, err)
+	}
+	readAuthFile := func() map[string]interface{} {
+		contents, err := ioutil.ReadFile(authFile)
+		require.NoError(t, err)
+		res := map[string]interface{}{}
+		err = json.Unmarshal(contents, &res)
+		require.NoError(t, err)
+		return res
+	}
+	login := func(args ...string) (string, error) {
+		return runSkopeo(append([]string{"login", "--authfile", authFile, "--tls-verify=false"}, args...)...)
+	}
+	logout := func(args ...string) (string, error) {
+		return runSkopeo(append([]string{"logout", "--authfile", authFile}, args...)...)
+	}
+
+	// Credentials stored directly in the authentication file
+	writeAuthFile(`{"auths":{}}`)
+	out, err := login("--username", "user", "--password", "wrong", registry)
+	assertTestFailed(t, out, err, "Error logging into")
+	out, err = login("--username", "user", "--password", "pass", registry)
+	require.NoError(t, err)
+	assert.Equal(t, "Login Succeeded!\n", out)
+	assert.Contains(t, readAuthFile()["auths"], registry)
+	out, err = login("--get-login", registry)
+	require.NoError(t, err)
+	assert.Equal(t, "user\n", out)
+	out, err = logout("--all")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, readAuthFile()["auths"])
+	out, err = login("--get-login", registry)
+	assertTestFailed(t, out, err, "Not logged into")
+
+	// Credentials stored using credsStore
+	writeAuthFile(`{"auths":{},"credsStore":"fake"}`)
+	out, err = login("--username", "user", "--password", "pass", registry)
+	require.NoError(t, err)
+	assert.Equal(t, "Credentials stored using credential helper fake\nLogin Succeeded!\n", out)
+	_, err = os.Stat(helperFile)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{registry: map[string]interface{}{}}, readAuthFile()["auths"])
+	out, err = login("--get-login", registry)
+	require.NoError(t, err)
+	assert.Equal(t, "user\n", out)
+	out, err = login("--list")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s: user\n", registry), out)
+	out, err = logout(registry)
+	require.NoError(t, err)
+	_, err = os.Stat(helperFile)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, map[string]interface{}{}, readAuthFile()["auths"])
+	out, err = logout(registry)
+	assertTestFailed(t, out, err, "credentials not found")
+
+	// Credentials stored using a per-registry credHelpers entry
+	writeAuthFile(fmt.Sprintf(`{"auths":{},"credHelpers":{"%s":"fake"}}`, registry))
+	out, err = login("--username", "user", "--password", "pass", registry)
+	require.NoError(t, err)
+	_, err = os.Stat(helperFile)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, readAuthFile()["auths"])
+	out, err = login("--list")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s: user\n", registry), out)
+	out, err = logout("--all")
+	require.NoError(t, err)
+	_, err = os.Stat(helperFile)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, map[string]interface{}{registry: "fake"}, readAuthFile()["credHelpers"])
+
+	// A configured credential helper which is not installed
+	writeAuthFile(`{"auths":{},"credsStore":"missing"}`)
+	out, err = login("--username", "user", "--password", "pass", registry)
+	assertTestFailed(t, out, err, `credential helper "missing"`)
+	out, err = logout(registry)
+	assertTestFailed(t, out, err, `credential helper "missing"`)
+	// … but credentials stored directly in the file are still listed.
+	writeAuthFile(fmt.Sprintf(`{"auths":{"%s":{"auth":"dXNlcjpwYXNz"}},"credsStore":"missing"}`, registry))
+	out, err = login("--list")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s: user\n", registry), out)
+}
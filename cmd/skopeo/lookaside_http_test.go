@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webDAVServer is a minimal WebDAV-like server storing files in memory, which requires authentication for writing.
+type webDAVServer struct {
+	mu            sync.Mutex
+	files         map[string][]byte
+	collections   map[string]bool
+	authenticated []string // Methods of requests containing credentials
+}
+
+func (s *webDAVServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("Authorization") != "" {
+		s.authenticated = append(s.authenticated, r.Method)
+	}
+	if r.Method != http.MethodGet {
+		if username, password, ok := r.BasicAuth(); (!ok || username != "user" || password != "pass") &&
+			r.Header.Get("Authorization") != "Bearer sigstore-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	p := path.Clean(r.URL.Path)
+	switch r.Method {
+	case http.MethodGet:
+		contents, ok := s.files[p]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(contents)
+	case http.MethodPut:
+		if !s.collections[path.Dir(p)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		contents, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.files[p] = contents
+		w.WriteHeader(http.StatusCreated)
+	case "MKCOL":
+		switch {
+		case s.collections[p]:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case !s.collections[path.Dir(p)]:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			s.collections[p] = true
+			w.WriteHeader(http.StatusCreated)
+		}
+	case http.MethodDelete:
+		if _, ok := s.files[p]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(s.files, p)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHTTPSignatureStorage(t *testing.T) {
+	os.Setenv("GNUPGHOME", "fixtures")
+	defer os.Unsetenv("GNUPGHOME")
+
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	registry := newTestRegistry(manifest)
+	defer registry.Close()
+	registryHost := strings.TrimPrefix(registry.URL, "http://")
+	image := "docker://" + registryHost + "/busybox:latest"
+
+	// The signatures exist, but the server does not know about the collections containing them.
+	sigDir := fmt.Sprintf("/sigstore/busybox@%s=%s", fixturesTestImageManifestDigest.Algorithm(), fixturesTestImageManifestDigest.Hex())
+	validSig, err := ioutil.ReadFile("fixtures/image.signature")
+	require.NoError(t, err)
+	otherSig := []byte("not a signature") // Not known to be made by the removed key, so it is kept.
+	storage := &webDAVServer{
+		files: map[string][]byte{
+			sigDir + "/signature-1": validSig,
+			sigDir + "/signature-2": otherSig,
+		},
+		collections: map[string]bool{"/": true},
+	}
+	sigstore := httptest.NewServer(storage)
+	defer sigstore.Close()
+	sigstoreHost := strings.TrimPrefix(sigstore.URL, "http://")
+
+	dir, err := ioutil.TempDir("", "skopeo-lookaside-http")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer setEnv("HOME", dir)() // Don't use the user's .docker/config.json
+	registriesD := filepath.Join(dir, "registries.d")
+	err = os.Mkdir(registriesD, 0755)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(registriesD, "sigstore.yaml"),
+		[]byte(fmt.Sprintf("docker:\n  %s:\n    sigstore: %s/sigstore\n    sigstore-staging: %s/sigstore\n", registryHost, sigstore.URL, sigstore.URL)), 0644)
+	require.NoError(t, err)
+	authFile := filepath.Join(dir, "auth.json")
+
+	remove := func(args ...string) (string, error) {
+		return runSkopeo(append(append([]string{"--registries.d", registriesD, "signatures", "remove", "--tls-verify=false",
+			"--authfile", authFile, "--key-id", fixturesTestKeyFingerprint}, args...), image)...)
+	}
+
+	// Without credentials for the signature storage, writing fails.
+	err = ioutil.WriteFile(authFile, []byte(`{"auths":{}}`), 0600)
+	require.NoError(t, err)
+	out, err := remove()
+	assertTestFailed(t, out, err, "status 401")
+
+	// Credentials for the registry are not sent to the signature storage.
+	out, err = remove("--creds", "user:pass")
+	assertTestFailed(t, out, err, "status 401")
+
+	// With credentials in the authentication file, the signatures are replaced, creating the collections.
+	err = ioutil.WriteFile(authFile, []byte(fmt.Sprintf(`{"auths":{"%s":{"auth":"dXNlcjpwYXNz"}}}`, sigstoreHost)), 0600)
+	require.NoError(t, err)
+	out, err = remove()
+	require.NoError(t, err)
+	assert.Empty(t, out)
+	assert.Equal(t, map[string][]byte{sigDir + "/signature-1": otherSig}, storage.files)
+	assert.True(t, storage.collections[sigDir])
+
+	out, err = runSkopeo("--registries.d", registriesD, "signatures", "list", "--tls-verify=false", "--authfile", authFile, image)
+	require.NoError(t, err)
+	assert.NotContains(t, out, fixturesTestKeyFingerprint)
+	assert.Contains(t, out, `"Index": 0`)
+	assert.NotContains(t, out, `"Index": 1`)
+	// Signatures are read anonymously, even if credentials for the signature storage are available.
+	assert.NotContains(t, storage.authenticated, http.MethodGet)
+	assert.Contains(t, storage.authenticated, http.MethodPut)
+
+	// A registry token in the authentication file is used as a bearer token.
+	storage.files[sigDir+"/signature-1"] = validSig
+	storage.files[sigDir+"/signature-2"] = otherSig
+	err = ioutil.WriteFile(authFile, []byte(fmt.Sprintf(`{"auths":{"%s":{"registrytoken":"sigstore-token"}}}`, sigstoreHost)), 0600)
+	require.NoError(t, err)
+	out, err = remove()
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{sigDir + "/signature-1": otherSig}, storage.files)
+
+	// Reading signatures does not depend on the credentials for the signature storage being available.
+	err = ioutil.WriteFile(authFile, []byte(fmt.Sprintf(`{"credHelpers":{"%s":"missing"}}`, sigstoreHost)), 0600)
+	require.NoError(t, err)
+	out, err = runSkopeo("--registries.d", registriesD, "signatures", "list", "--tls-verify=false", "--authfile", authFile, image)
+	require.NoError(t, err)
+	assert.Contains(t, out, `"Index": 0`)
+	storage.files[sigDir+"/signature-2"] = validSig
+	out, err = remove()
+	assertTestFailed(t, out, err, "status 401")
+}
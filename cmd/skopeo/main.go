@@ -27,6 +27,7 @@ type globalOptions struct {
 	overrideOS         string        // OS to use for choosing images, instead of the runtime one
 	commandTimeout     time.Duration // Timeout for the command execution
 	registriesConfPath string        // Path to the "registries.conf" file
+	tokenCacheDir      string        // Path to a directory for caching bearer tokens across invocations
 }
 
 // createApp returns a cli.App, and the underlying globalOptions object, to be run or tested.
@@ -84,6 +85,11 @@ func createApp() (*cli.App, *globalOptions) {
 			Usage:       "timeout for the command execution",
 			Destination: &opts.commandTimeout,
 		},
+		cli.StringFlag{
+			Name:        "token-cache-dir",
+			Usage:       "cache registry bearer tokens in `DIR`, and reuse them across invocations",
+			Destination: &opts.tokenCacheDir,
+		},
 		cli.StringFlag{
 			Name:        "registries-conf",
 			Usage:       "path to the registries.conf file",
@@ -95,9 +101,19 @@ func createApp() (*cli.App, *globalOptions) {
 	app.Commands = []cli.Command{
 		copyCmd(&opts),
 		inspectCmd(&opts),
+		diffCmd(&opts),
+		extractCmd(&opts),
+		verifyCmd(&opts),
+		blobCmd(&opts),
 		layersCmd(&opts),
 		deleteCmd(&opts),
-		manifestDigestCmd(),
+		signCmd(&opts),
+		signaturesCmd(&opts),
+		registriesDCmd(&opts),
+		loginCmd(&opts),
+		logoutCmd(&opts),
+		manifestDigestCmd(&opts),
+		manifestCmd(&opts),
 		standaloneSignCmd(),
 		standaloneVerifyCmd(),
 		untrustedSignatureDumpCmd(),
@@ -1,6 +1,20 @@
 package main
 
-import "bytes"
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/containers/storage/pkg/reexec"
+)
+
+// TestMain allows the test binary to be re-executed, as containers-storage does e.g. to apply layers in a chroot.
+func TestMain(m *testing.M) {
+	if reexec.Init() {
+		return
+	}
+	os.Exit(m.Run())
+}
 
 // runSkopeo creates an app object and runs it with args, with an implied first "skopeo".
 // Returns output intended for stdout and the returned error, if any.
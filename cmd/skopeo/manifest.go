@@ -1,42 +1,873 @@
 package main
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"strings"
 
+	"github.com/containers/image/docker"
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/image"
 	"github.com/containers/image/manifest"
+	"github.com/containers/image/oci/layout"
+	"github.com/containers/image/transports"
+	"github.com/containers/image/transports/alltransports"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
 	"github.com/urfave/cli"
 )
 
 type manifestDigestOptions struct {
+	global    *globalOptions
+	image     *imageOptions
+	algorithm string // The digest algorithm to use
+	instances bool   // Also write the digests of the images in a manifest list
 }
 
-func manifestDigestCmd() cli.Command {
-	opts := manifestDigestOptions{}
+func manifestDigestCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageFlags(global, sharedOpts, "", "")
+	opts := manifestDigestOptions{
+		global: global,
+		image:  imageOpts,
+	}
 	return cli.Command{
-		Name:      "manifest-digest",
-		Usage:     "Compute a manifest digest of a file",
-		ArgsUsage: "MANIFEST",
+		Name:  "manifest-digest",
+		Usage: "Compute a manifest digest of a file or an image",
+		Description: `
+	Compute a manifest digest of "MANIFEST", a file, or of the manifest of "IMAGE-NAME", and write it to standard output
+
+	With --instances, for manifest lists, the digest of each image in the list follows on a separate line, with its platform
+
+	See skopeo(1) section "IMAGE NAMES" for the expected format
+	`,
+		ArgsUsage: "MANIFEST | IMAGE-NAME",
 		Action:    commandAction(opts.run),
+		Flags: append(append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "algorithm",
+				Usage:       "compute digests using `ALGORITHM` (sha256, sha384 or sha512)",
+				Value:       string(digest.Canonical),
+				Destination: &opts.algorithm,
+			},
+			cli.BoolFlag{
+				Name:        "instances",
+				Usage:       "also write the digests of the images in a manifest list, with their platforms",
+				Destination: &opts.instances,
+			},
+		}, sharedFlags...), imageFlags...),
 	}
 }
 
-func (opts *manifestDigestOptions) run(args []string, stdout io.Writer) error {
+func (opts *manifestDigestOptions) run(args []string, stdout io.Writer) (retErr error) {
 	if len(args) != 1 {
-		return errors.New("Usage: skopeo manifest-digest manifest")
+		return errors.New("Usage: skopeo manifest-digest [--algorithm ALGORITHM] [--instances] MANIFEST | IMAGE-NAME")
+	}
+	algorithm := digest.Algorithm(opts.algorithm)
+	if !algorithm.Available() {
+		return fmt.Errorf("Unsupported digest algorithm %q", opts.algorithm)
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	var (
+		src      types.ImageSource // nil if args[0] is a file
+		man      []byte
+		mimeType string
+	)
+	if _, err := alltransports.ParseImageName(args[0]); err == nil {
+		imageName := args[0]
+		if err := reexecIfNecessaryForImages(imageName); err != nil {
+			return err
+		}
+		src, err = parseImageSource(ctx, opts.image, imageName)
+		if err != nil {
+			return fmt.Errorf("Error parsing image name %q: %v", imageName, err)
+		}
+		defer func() {
+			if err := src.Close(); err != nil {
+				retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+			}
+		}()
+		man, mimeType, err = src.GetManifest(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("Error reading manifest of %s: %v", imageName, err)
+		}
+	} else {
+		manifestPath := args[0]
+		man, err = ioutil.ReadFile(manifestPath)
+		if err != nil {
+			return fmt.Errorf("Error reading manifest from %s: %v", manifestPath, err)
+		}
+	}
+	if mimeType == "" {
+		mimeType = manifest.GuessMIMEType(man)
+	}
+
+	manifestDigest, err := manifest.DigestWithAlgorithm(man, algorithm)
+	if err != nil {
+		return fmt.Errorf("Error computing digest: %v", err)
+	}
+	fmt.Fprintf(stdout, "%s\n", manifestDigest)
+
+	if !opts.instances || !isManifestList(mimeType) {
+		return nil
+	}
+	instances, err := parseManifestList(man, mimeType)
+	if err != nil {
+		return err
+	}
+	for _, instance := range instances {
+		instanceDigest, err := listInstanceDigest(ctx, src, instance, algorithm)
+		if err != nil {
+			return err
+		}
+		if instance.Platform.OS != "" {
+			fmt.Fprintf(stdout, "%s %s\n", instanceDigest, instance.Platform)
+		} else {
+			fmt.Fprintf(stdout, "%s\n", instanceDigest)
+		}
+	}
+	return nil
+}
+
+// listInstanceDigest returns the digest of instance computed using algorithm, reading its manifest from src if it is not nil.
+func listInstanceDigest(ctx context.Context, src types.ImageSource, instance listInstance, algorithm digest.Algorithm) (digest.Digest, error) {
+	if src == nil {
+		if instance.Digest.Algorithm() != algorithm {
+			return "", fmt.Errorf("Computing %s digests of images in a manifest list requires an image name, not a file", algorithm)
+		}
+		return instance.Digest, nil
+	}
+	man, _, err := src.GetManifest(ctx, &instance.Digest)
+	if err != nil {
+		return "", fmt.Errorf("Error reading manifest %s: %v", instance.Digest, err)
+	}
+	matches, err := manifest.MatchesDigest(man, instance.Digest)
+	if err != nil {
+		return "", fmt.Errorf("Error computing digest of manifest %s: %v", instance.Digest, err)
+	}
+	if !matches {
+		return "", fmt.Errorf("Manifest %s does not match its digest", instance.Digest)
+	}
+	return manifest.DigestWithAlgorithm(man, algorithm)
+}
+
+func manifestCmd(global *globalOptions) cli.Command {
+	return cli.Command{
+		Name:  "manifest",
+		Usage: "Create, edit and push manifest lists",
+		Subcommands: []cli.Command{
+			manifestCreateCmd(global),
+			manifestAddCmd(global),
+			manifestAnnotateCmd(global),
+			manifestPushCmd(global),
+		},
+	}
+}
+
+const manifestListDescription = `
+	"LIST" is either a path of a JSON file, or an oci: image name referring to an OCI image layout.
+
+	See skopeo(1) section "IMAGE NAMES" for the expected format
+	`
+
+// editableList is a Docker manifest list or an OCI image index edited by (skopeo manifest).
+type editableList struct {
+	docker *manifest.Schema2List // Set if the list is a Docker manifest list
+	oci    *imgspecv1.Index      // Set if the list is an OCI image index
+}
+
+// newEditableList returns an empty list in format, either "v2s2" or "oci".
+func newEditableList(format string) (*editableList, error) {
+	switch format {
+	case "v2s2":
+		return &editableList{docker: &manifest.Schema2List{
+			SchemaVersion: 2,
+			MediaType:     manifest.DockerV2ListMediaType,
+			Manifests:     []manifest.Schema2ManifestDescriptor{},
+		}}, nil
+	case "oci":
+		return &editableList{oci: &imgspecv1.Index{
+			Versioned: imgspec.Versioned{SchemaVersion: 2},
+			Manifests: []imgspecv1.Descriptor{},
+		}}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q. Choose one of the supported formats: 'oci' or 'v2s2'", format)
+	}
+}
+
+// parseEditableList parses blob, a Docker manifest list or an OCI image index.
+func parseEditableList(blob []byte) (*editableList, error) {
+	// manifest.GuessMIMEType does not recognize empty OCI indexes.
+	meta := struct {
+		MediaType     string           `json:"mediaType"`
+		SchemaVersion int              `json:"schemaVersion"`
+		Manifests     *json.RawMessage `json:"manifests"`
+	}{}
+	if err := json.Unmarshal(blob, &meta); err != nil {
+		return nil, fmt.Errorf("Error parsing manifest list: %v", err)
+	}
+	switch {
+	case meta.MediaType == manifest.DockerV2ListMediaType:
+		list, err := manifest.Schema2ListFromManifest(blob)
+		if err != nil {
+			return nil, err
+		}
+		return &editableList{docker: list}, nil
+	case (meta.MediaType == "" || meta.MediaType == imgspecv1.MediaTypeImageIndex) && meta.SchemaVersion == 2 && meta.Manifests != nil:
+		index := imgspecv1.Index{}
+		if err := json.Unmarshal(blob, &index); err != nil {
+			return nil, fmt.Errorf("Error parsing OCI image index: %v", err)
+		}
+		return &editableList{oci: &index}, nil
+	default:
+		return nil, errors.New("Not a Docker manifest list or an OCI image index")
+	}
+}
+
+func (l *editableList) serialize() ([]byte, error) {
+	if l.docker != nil {
+		return json.Marshal(l.docker)
+	}
+	return json.Marshal(l.oci)
+}
+
+func (l *editableList) instances() []digest.Digest {
+	if l.docker != nil {
+		return l.docker.Instances()
+	}
+	res := []digest.Digest{}
+	for _, m := range l.oci.Manifests {
+		res = append(res, m.Digest)
+	}
+	return res
+}
+
+// addInstance adds an image with manifestDigest, mimeType and size, built for os and arch, to l,
+// replacing an existing entry for manifestDigest.
+func (l *editableList) addInstance(manifestDigest digest.Digest, mimeType string, size int64, os, arch string) error {
+	if l.docker != nil {
+		switch mimeType {
+		case manifest.DockerV2Schema2MediaType, manifest.DockerV2Schema1SignedMediaType, manifest.DockerV2Schema1MediaType:
+		default:
+			return fmt.Errorf("Images with manifest type %s can not be included in a Docker manifest list", mimeType)
+		}
+		m := manifest.Schema2ManifestDescriptor{
+			Schema2Descriptor: manifest.Schema2Descriptor{MediaType: mimeType, Size: size, Digest: manifestDigest},
+			Platform:          manifest.Schema2PlatformSpec{OS: os, Architecture: arch},
+		}
+		for i := range l.docker.Manifests {
+			if l.docker.Manifests[i].Digest == manifestDigest {
+				l.docker.Manifests[i] = m
+				return nil
+			}
+		}
+		l.docker.Manifests = append(l.docker.Manifests, m)
+		return nil
+	}
+
+	if mimeType != imgspecv1.MediaTypeImageManifest {
+		return fmt.Errorf("Images with manifest type %s can not be included in an OCI image index", mimeType)
+	}
+	m := imgspecv1.Descriptor{
+		MediaType: mimeType,
+		Size:      size,
+		Digest:    manifestDigest,
+		Platform:  &imgspecv1.Platform{OS: os, Architecture: arch},
+	}
+	for i := range l.oci.Manifests {
+		if l.oci.Manifests[i].Digest == manifestDigest {
+			l.oci.Manifests[i] = m
+			return nil
+		}
+	}
+	l.oci.Manifests = append(l.oci.Manifests, m)
+	return nil
+}
+
+// updateInstance modifies the entry for manifestDigest in l as specified by opts.
+func (l *editableList) updateInstance(manifestDigest digest.Digest, opts *listEntryOptions) error {
+	annotations, err := parseAnnotations(opts.annotations)
+	if err != nil {
+		return err
+	}
+	if l.docker != nil {
+		if len(annotations) != 0 {
+			return errors.New("Annotations are only supported in OCI image indexes")
+		}
+		for i := range l.docker.Manifests {
+			if l.docker.Manifests[i].Digest == manifestDigest {
+				p := &l.docker.Manifests[i].Platform
+				opts.updatePlatform(&p.OS, &p.Architecture, &p.Variant, &p.OSVersion, &p.OSFeatures)
+				if len(opts.features) != 0 {
+					p.Features = []string(opts.features)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("Image %s not found in manifest list", manifestDigest)
+	}
+
+	if len(opts.features) != 0 {
+		return errors.New("--features is only supported in Docker manifest lists, use --os-features")
+	}
+	for i := range l.oci.Manifests {
+		m := &l.oci.Manifests[i]
+		if m.Digest == manifestDigest {
+			if m.Platform == nil {
+				m.Platform = &imgspecv1.Platform{}
+			}
+			p := m.Platform
+			opts.updatePlatform(&p.OS, &p.Architecture, &p.Variant, &p.OSVersion, &p.OSFeatures)
+			if len(annotations) != 0 && m.Annotations == nil {
+				m.Annotations = map[string]string{}
+			}
+			for k, v := range annotations {
+				m.Annotations[k] = v
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("Image %s not found in manifest list", manifestDigest)
+}
+
+// setAnnotations adds annotations to the annotations of l itself.
+func (l *editableList) setAnnotations(annotations map[string]string) error {
+	if len(annotations) == 0 {
+		return nil
+	}
+	if l.docker != nil {
+		return errors.New("Annotations are only supported in OCI image indexes")
+	}
+	if l.oci.Annotations == nil {
+		l.oci.Annotations = map[string]string{}
+	}
+	for k, v := range annotations {
+		l.oci.Annotations[k] = v
+	}
+	return nil
+}
+
+// parseAnnotations parses values in the KEY=VALUE format.
+func parseAnnotations(values []string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, v := range values {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Invalid annotation %q, expected KEY=VALUE", v)
+		}
+		res[kv[0]] = kv[1]
+	}
+	return res, nil
+}
+
+// manifestListReference returns an oci: reference if name is an image name, or nil if name is a path of a JSON file.
+func manifestListReference(name string) (types.ImageReference, error) {
+	ref, err := alltransports.ParseImageName(name)
+	if err != nil {
+		return nil, nil
+	}
+	if ref.Transport().Name() != layout.Transport.Name() {
+		return nil, fmt.Errorf("Manifest lists can only be stored in files or in %s: layouts, not in %s", layout.Transport.Name(), name)
+	}
+	return ref, nil
+}
+
+// readEditableList reads the list stored at name, see manifestListReference.
+func readEditableList(ctx context.Context, sys *types.SystemContext, name string) (_ *editableList, retErr error) {
+	ref, err := manifestListReference(name)
+	if err != nil {
+		return nil, err
+	}
+	var blob []byte
+	if ref == nil {
+		blob, err = ioutil.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading manifest list from %s: %v", name, err)
+		}
+	} else {
+		src, err := ref.NewImageSource(ctx, sys)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading manifest list from %s: %v", name, err)
+		}
+		defer func() {
+			if err := src.Close(); err != nil {
+				retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+			}
+		}()
+		blob, _, err = src.GetManifest(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading manifest list from %s: %v", name, err)
+		}
+	}
+	list, err := parseEditableList(blob)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading manifest list from %s: %v", name, err)
+	}
+	return list, nil
+}
+
+// writeEditableList stores list at name, see manifestListReference.
+func writeEditableList(ctx context.Context, sys *types.SystemContext, name string, list *editableList) (retErr error) {
+	ref, err := manifestListReference(name)
+	if err != nil {
+		return err
+	}
+	blob, err := list.serialize()
+	if err != nil {
+		return err
+	}
+	if ref == nil {
+		return ioutil.WriteFile(name, blob, 0644)
+	}
+
+	if list.docker != nil {
+		return fmt.Errorf("Docker manifest lists can not be stored in %s: layouts, use --format oci", layout.Transport.Name())
+	}
+	dest, err := ref.NewImageDestination(ctx, sys)
+	if err != nil {
+		return fmt.Errorf("Error initializing %s: %v", name, err)
+	}
+	defer func() {
+		if err := dest.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		}
+	}()
+	if err := dest.PutManifest(ctx, blob); err != nil {
+		return fmt.Errorf("Error writing manifest list to %s: %v", name, err)
+	}
+	return dest.Commit(ctx)
+}
+
+// addImageToList adds the image imageName to list, and returns its manifest digest.
+func addImageToList(ctx context.Context, imageOpts *imageOptions, list *editableList, imageName string) (_ digest.Digest, retErr error) {
+	if err := reexecIfNecessaryForImages(imageName); err != nil {
+		return "", err
+	}
+	sys, err := imageOpts.newSystemContext()
+	if err != nil {
+		return "", err
+	}
+	src, err := parseImageSource(ctx, imageOpts, imageName)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing image name %q: %v", imageName, err)
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		}
+	}()
+	unparsed := image.UnparsedInstance(src, nil)
+	man, mimeType, err := unparsed.Manifest(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Error reading manifest of %s: %v", imageName, err)
+	}
+	if isManifestList(mimeType) {
+		return "", fmt.Errorf("%s is a manifest list, only individual images can be added", imageName)
+	}
+	img, err := image.FromUnparsedImage(ctx, sys, unparsed)
+	if err != nil {
+		return "", fmt.Errorf("Error reading %s: %v", imageName, err)
+	}
+	manifestDigest, err := manifest.Digest(man)
+	if err != nil {
+		return "", fmt.Errorf("Error computing digest: %v", err)
+	}
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Error reading OCI-formatted configuration data: %v", err)
+	}
+	if err := list.addInstance(manifestDigest, mimeType, int64(len(man)), config.OS, config.Architecture); err != nil {
+		return "", fmt.Errorf("Error adding %s: %v", imageName, err)
 	}
-	manifestPath := args[0]
+	return manifestDigest, nil
+}
+
+// listEntryOptions modify an entry of a manifest list, in (skopeo manifest add) and (skopeo manifest annotate).
+type listEntryOptions struct {
+	os          string
+	arch        string
+	variant     string
+	osVersion   string
+	osFeatures  cli.StringSlice
+	features    cli.StringSlice
+	annotations cli.StringSlice
+}
+
+// listEntryFlags prepares a collection of CLI flags writing into listEntryOptions, and the managed listEntryOptions structure.
+func listEntryFlags() ([]cli.Flag, *listEntryOptions) {
+	opts := listEntryOptions{}
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "os",
+			Usage:       "set the operating system of the image to `OS`",
+			Destination: &opts.os,
+		},
+		cli.StringFlag{
+			Name:        "arch",
+			Usage:       "set the CPU architecture of the image to `ARCH`",
+			Destination: &opts.arch,
+		},
+		cli.StringFlag{
+			Name:        "variant",
+			Usage:       "set the CPU variant of the image to `VARIANT`",
+			Destination: &opts.variant,
+		},
+		cli.StringFlag{
+			Name:        "os-version",
+			Usage:       "set the operating system version required by the image to `VERSION`",
+			Destination: &opts.osVersion,
+		},
+		cli.StringSliceFlag{
+			Name:  "os-features",
+			Usage: "set the operating system features required by the image to `FEATURE` (can be repeated)",
+			Value: &opts.osFeatures, // Surprisingly StringSliceFlag does not support Destination:, but modifies Value: in place.
+		},
+		cli.StringSliceFlag{
+			Name:  "features",
+			Usage: "set the CPU features required by the image to `FEATURE` (can be repeated, Docker manifest lists only)",
+			Value: &opts.features, // Surprisingly StringSliceFlag does not support Destination:, but modifies Value: in place.
+		},
+		cli.StringSliceFlag{
+			Name:  "annotation",
+			Usage: "add an annotation `KEY=VALUE` to the entry of the image (can be repeated, OCI image indexes only)",
+			Value: &opts.annotations, // Surprisingly StringSliceFlag does not support Destination:, but modifies Value: in place.
+		},
+	}, &opts
+}
+
+// updatePlatform updates the platform fields pointed to by the parameters with the values specified in opts.
+func (opts *listEntryOptions) updatePlatform(os, arch, variant, osVersion *string, osFeatures *[]string) {
+	for _, v := range []struct {
+		dest  *string
+		value string
+	}{{os, opts.os}, {arch, opts.arch}, {variant, opts.variant}, {osVersion, opts.osVersion}} {
+		if v.value != "" {
+			*v.dest = v.value
+		}
+	}
+	if len(opts.osFeatures) != 0 {
+		*osFeatures = opts.osFeatures
+	}
+}
+
+type manifestCreateOptions struct {
+	global      *globalOptions
+	image       *imageOptions
+	format      string          // The format of the list, "v2s2" or "oci"
+	annotations cli.StringSlice // Annotations of the list
+}
+
+func manifestCreateCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageFlags(global, sharedOpts, "", "")
+	opts := manifestCreateOptions{
+		global: global,
+		image:  imageOpts,
+	}
+	return cli.Command{
+		Name:  "create",
+		Usage: "Create a manifest list LIST containing IMAGE-NAME...",
+		Description: `
+	Create a new manifest list "LIST", and add the images "IMAGE-NAME..." to it, with the platforms recorded in their configurations
+	` + manifestListDescription,
+		ArgsUsage: "LIST [IMAGE-NAME...]",
+		Action:    commandAction(opts.run),
+		Flags: append(append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "format, f",
+				Usage:       "`LIST TYPE` (oci or v2s2) to create",
+				Value:       "v2s2",
+				Destination: &opts.format,
+			},
+			cli.StringSliceFlag{
+				Name:  "annotation",
+				Usage: "add an annotation `KEY=VALUE` to the list (can be repeated, OCI image indexes only)",
+				Value: &opts.annotations, // Surprisingly StringSliceFlag does not support Destination:, but modifies Value: in place.
+			},
+		}, sharedFlags...), imageFlags...),
+	}
+}
+
+func (opts *manifestCreateOptions) run(args []string, stdout io.Writer) error {
+	if len(args) < 1 {
+		return errors.New("Usage: skopeo manifest create LIST [IMAGE-NAME...]")
+	}
+	listName, imageNames := args[0], args[1:]
+	list, err := newEditableList(opts.format)
+	if err != nil {
+		return err
+	}
+	annotations, err := parseAnnotations(opts.annotations)
+	if err != nil {
+		return err
+	}
+	if err := list.setAnnotations(annotations); err != nil {
+		return err
+	}
+	ref, err := manifestListReference(listName)
+	if err != nil {
+		return err
+	}
+	if ref == nil {
+		if _, err := os.Lstat(listName); err == nil {
+			return fmt.Errorf("%s already exists", listName)
+		}
+	} else if _, err := layout.LoadManifestDescriptor(ref); err == nil {
+		return fmt.Errorf("%s already exists", listName)
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	for _, imageName := range imageNames {
+		if _, err := addImageToList(ctx, opts.image, list, imageName); err != nil {
+			return err
+		}
+	}
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+	return writeEditableList(ctx, sys, listName, list)
+}
+
+type manifestAddOptions struct {
+	global *globalOptions
+	image  *imageOptions
+	entry  *listEntryOptions
+}
+
+func manifestAddCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageFlags(global, sharedOpts, "", "")
+	entryFlags, entryOpts := listEntryFlags()
+	opts := manifestAddOptions{
+		global: global,
+		image:  imageOpts,
+		entry:  entryOpts,
+	}
+	return cli.Command{
+		Name:  "add",
+		Usage: "Add IMAGE-NAME to the manifest list LIST",
+		Description: `
+	Add the image "IMAGE-NAME" to the manifest list "LIST", replacing an existing entry for the same image,
+	and write its manifest digest to standard output
+
+	The platform recorded in the configuration of the image is used, unless overridden by the options
+	` + manifestListDescription,
+		ArgsUsage: "LIST IMAGE-NAME",
+		Action:    commandAction(opts.run),
+		Flags:     append(append(entryFlags, sharedFlags...), imageFlags...),
+	}
+}
+
+func (opts *manifestAddOptions) run(args []string, stdout io.Writer) error {
+	if len(args) != 2 {
+		return errors.New("Usage: skopeo manifest add LIST IMAGE-NAME")
+	}
+	listName, imageName := args[0], args[1]
 
-	man, err := ioutil.ReadFile(manifestPath)
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+	list, err := readEditableList(ctx, sys, listName)
 	if err != nil {
-		return fmt.Errorf("Error reading manifest from %s: %v", manifestPath, err)
+		return err
 	}
-	digest, err := manifest.Digest(man)
+	manifestDigest, err := addImageToList(ctx, opts.image, list, imageName)
+	if err != nil {
+		return err
+	}
+	if err := list.updateInstance(manifestDigest, opts.entry); err != nil {
+		return err
+	}
+	if err := writeEditableList(ctx, sys, listName, list); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s\n", manifestDigest)
+	return nil
+}
+
+type manifestAnnotateOptions struct {
+	global *globalOptions
+	entry  *listEntryOptions
+}
+
+func manifestAnnotateCmd(global *globalOptions) cli.Command {
+	entryFlags, entryOpts := listEntryFlags()
+	opts := manifestAnnotateOptions{
+		global: global,
+		entry:  entryOpts,
+	}
+	return cli.Command{
+		Name:  "annotate",
+		Usage: "Set the platform and annotations of the image with DIGEST in the manifest list LIST",
+		Description: `
+	Set the platform and annotations of the image with "DIGEST" in the manifest list "LIST"
+	` + manifestListDescription,
+		ArgsUsage: "LIST DIGEST",
+		Action:    commandAction(opts.run),
+		Flags:     entryFlags,
+	}
+}
+
+func (opts *manifestAnnotateOptions) run(args []string, stdout io.Writer) error {
+	if len(args) != 2 {
+		return errors.New("Usage: skopeo manifest annotate LIST DIGEST")
+	}
+	listName := args[0]
+	manifestDigest, err := digest.Parse(args[1])
+	if err != nil {
+		return fmt.Errorf("Invalid digest %s: %v", args[1], err)
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	list, err := readEditableList(ctx, nil, listName)
+	if err != nil {
+		return err
+	}
+	if err := list.updateInstance(manifestDigest, opts.entry); err != nil {
+		return err
+	}
+	return writeEditableList(ctx, nil, listName, list)
+}
+
+type manifestPushOptions struct {
+	global *globalOptions
+	image  *imageDestOptions
+}
+
+func manifestPushCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageDestFlags(global, sharedOpts, "", "")
+	opts := manifestPushOptions{
+		global: global,
+		image:  imageOpts,
+	}
+	return cli.Command{
+		Name:  "push",
+		Usage: "Push the manifest list LIST to DESTINATION-IMAGE",
+		Description: `
+	Push the manifest list "LIST" to "DESTINATION-IMAGE", a docker:// reference, and write its digest to standard output
+
+	All images in the list must already exist in the repository of "DESTINATION-IMAGE", e.g. copied there using (skopeo copy)
+	` + manifestListDescription,
+		ArgsUsage: "LIST DESTINATION-IMAGE",
+		Action:    commandAction(opts.run),
+		Flags:     append(sharedFlags, imageFlags...),
+	}
+}
+
+func (opts *manifestPushOptions) run(args []string, stdout io.Writer) (retErr error) {
+	if len(args) != 2 {
+		return errors.New("Usage: skopeo manifest push LIST DESTINATION-IMAGE")
+	}
+	listName, destName := args[0], args[1]
+	destRef, err := alltransports.ParseImageName(destName)
+	if err != nil {
+		return fmt.Errorf("Invalid image name %s: %v", destName, err)
+	}
+	if destRef.Transport().Name() != docker.Transport.Name() {
+		return fmt.Errorf("Only %s:// destinations are supported, not %s", docker.Transport.Name(), destName)
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+	list, err := readEditableList(ctx, sys, listName)
+	if err != nil {
+		return err
+	}
+	instances := list.instances()
+	if len(instances) == 0 {
+		return fmt.Errorf("Manifest list %s is empty", listName)
+	}
+	missing := []string{}
+	for _, instance := range instances {
+		if err := checkListInstanceExists(ctx, sys, destRef, instance); err != nil {
+			missing = append(missing, err.Error())
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("Images in the manifest list are not available in %s:\n%s", transports.ImageName(destRef), strings.Join(missing, "\n"))
+	}
+
+	blob, err := list.serialize()
+	if err != nil {
+		return err
+	}
+	listDigest, err := manifest.Digest(blob)
 	if err != nil {
 		return fmt.Errorf("Error computing digest: %v", err)
 	}
-	fmt.Fprintf(stdout, "%s\n", digest)
+	dest, err := destRef.NewImageDestination(ctx, sys)
+	if err != nil {
+		return fmt.Errorf("Error initializing %s: %v", transports.ImageName(destRef), err)
+	}
+	defer func() {
+		if err := dest.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		}
+	}()
+	if err := dest.PutManifest(ctx, blob); err != nil {
+		return fmt.Errorf("Error writing manifest list: %v", err)
+	}
+	if err := dest.Commit(ctx); err != nil {
+		return fmt.Errorf("Error committing the manifest list: %v", err)
+	}
+	fmt.Fprintf(stdout, "%s\n", listDigest)
+	return nil
+}
+
+// checkListInstanceExists returns an error if the image with instanceDigest does not exist in the repository of destRef.
+func checkListInstanceExists(ctx context.Context, sys *types.SystemContext, destRef types.ImageReference, instanceDigest digest.Digest) (retErr error) {
+	named, err := reference.WithDigest(reference.TrimNamed(destRef.DockerReference()), instanceDigest)
+	if err != nil {
+		return err
+	}
+	ref, err := docker.NewReference(named)
+	if err != nil {
+		return err
+	}
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return fmt.Errorf("%s: %v", instanceDigest, err)
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		}
+	}()
+	man, _, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", instanceDigest, err)
+	}
+	matches, err := manifest.MatchesDigest(man, instanceDigest)
+	if err != nil {
+		return fmt.Errorf("%s: %v", instanceDigest, err)
+	}
+	if !matches {
+		return fmt.Errorf("%s: manifest does not match its digest", instanceDigest)
+	}
 	return nil
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// listInstance describes an image in a Docker manifest list or an OCI image index.
+type listInstance struct {
+	Digest    digest.Digest
+	MediaType string
+	Size      int64
+	Platform  listPlatform
+}
+
+// listPlatform is the platform an image in a manifest list is specialized for.
+type listPlatform struct {
+	OS           string
+	Architecture string
+	Variant      string `json:",omitempty"`
+}
+
+func (p listPlatform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// isManifestList returns true if mimeType is a Docker manifest list or an OCI image index.
+func isManifestList(mimeType string) bool {
+	// manifest.NormalizedMIMEType does not recognize OCI indexes.
+	return mimeType == imgspecv1.MediaTypeImageIndex || manifest.NormalizedMIMEType(mimeType) == manifest.DockerV2ListMediaType
+}
+
+// parseManifestList parses blob, a Docker manifest list or an OCI image index of mimeType, and returns the images it contains.
+func parseManifestList(blob []byte, mimeType string) ([]listInstance, error) {
+	instances := []listInstance{}
+	if mimeType == imgspecv1.MediaTypeImageIndex {
+		index := imgspecv1.Index{}
+		if err := json.Unmarshal(blob, &index); err != nil {
+			return nil, fmt.Errorf("Error parsing OCI image index: %v", err)
+		}
+		for _, m := range index.Manifests {
+			instance := listInstance{Digest: m.Digest, MediaType: m.MediaType, Size: m.Size}
+			if m.Platform != nil {
+				instance.Platform = listPlatform{OS: m.Platform.OS, Architecture: m.Platform.Architecture, Variant: m.Platform.Variant}
+			}
+			instances = append(instances, instance)
+		}
+		return instances, nil
+	}
+	list, err := manifest.Schema2ListFromManifest(blob)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range list.Manifests {
+		instances = append(instances, listInstance{
+			Digest:    m.Digest,
+			MediaType: m.MediaType,
+			Size:      m.Size,
+			Platform:  listPlatform{OS: m.Platform.OS, Architecture: m.Platform.Architecture, Variant: m.Platform.Variant},
+		})
+	}
+	return instances, nil
+}
+
+// parsePlatform parses a platform in the os/arch[/variant] format.
+func parsePlatform(platform string) (listPlatform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return listPlatform{}, fmt.Errorf("Invalid platform %q, expected os/arch or os/arch/variant", platform)
+	}
+	res := listPlatform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		res.Variant = parts[2]
+	}
+	return res, nil
+}
+
+// defaultPlatform returns the platform used for choosing images from manifest lists, based on sys.
+func defaultPlatform(sys *types.SystemContext) listPlatform {
+	res := listPlatform{OS: runtime.GOOS, Architecture: runtime.GOARCH}
+	if sys != nil && sys.OSChoice != "" {
+		res.OS = sys.OSChoice
+	}
+	if sys != nil && sys.ArchitectureChoice != "" {
+		res.Architecture = sys.ArchitectureChoice
+	}
+	return res
+}
+
+// chooseListInstance returns the digest of the first image in instances matching platform.
+// If platform does not specify a variant, images of any variant match.
+func chooseListInstance(instances []listInstance, platform listPlatform) (digest.Digest, error) {
+	for _, instance := range instances {
+		if instance.Platform.OS == platform.OS && instance.Platform.Architecture == platform.Architecture &&
+			(platform.Variant == "" || instance.Platform.Variant == platform.Variant) {
+			return instance.Digest, nil
+		}
+	}
+	return "", fmt.Errorf("No image found in manifest list for platform %s", platform.String())
+}
+
+// findListInstance returns an error if instanceDigest is not one of instances.
+func findListInstance(instances []listInstance, instanceDigest digest.Digest) error {
+	for _, instance := range instances {
+		if instance.Digest == instanceDigest {
+			return nil
+		}
+	}
+	return fmt.Errorf("Image %s not found in manifest list", instanceDigest)
+}
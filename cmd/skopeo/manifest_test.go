@@ -1,9 +1,22 @@
 package main
 
 import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/containers/image/manifest"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestManifestDigest(t *testing.T) {
@@ -15,9 +28,11 @@ func TestManifestDigest(t *testing.T) {
 		out, err := runSkopeo(append([]string{"manifest-digest"}, args...)...)
 		assertTestFailed(t, out, err, "Usage")
 	}
+	out, err := runSkopeo("manifest-digest", "--algorithm", "md5", "fixtures/image.manifest.json")
+	assertTestFailed(t, out, err, "Unsupported digest algorithm")
 
 	// Error reading manifest
-	out, err := runSkopeo("manifest-digest", "/this/doesnt/exist")
+	out, err = runSkopeo("manifest-digest", "/this/doesnt/exist")
 	assertTestFailed(t, out, err, "/this/doesnt/exist")
 
 	// Error computing manifest
@@ -28,4 +43,247 @@ func TestManifestDigest(t *testing.T) {
 	out, err = runSkopeo("manifest-digest", "fixtures/image.manifest.json")
 	assert.NoError(t, err)
 	assert.Equal(t, fixturesTestImageManifestDigest.String()+"\n", out)
+
+	// Other algorithms
+	contents, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	sum := sha512.Sum512(contents)
+	sha512Digest := digest.NewDigestFromHex(string(digest.SHA512), hex.EncodeToString(sum[:]))
+	out, err = runSkopeo("manifest-digest", "--algorithm", "sha512", "fixtures/image.manifest.json")
+	assert.NoError(t, err)
+	assert.Equal(t, sha512Digest.String()+"\n", out)
+	matches, err := manifest.MatchesDigest(contents, sha512Digest)
+	require.NoError(t, err)
+	assert.True(t, matches)
+}
+
+func TestManifestDigestImage(t *testing.T) {
+	registry := newFakeRegistry()
+	defer registry.Close()
+	now := time.Now()
+	amd64 := registry.addImage(t, "multi", now, "linux", "amd64", "amd64", "amd64")
+	arm64 := registry.addImage(t, "multi", now, "linux", "arm64", "arm64")
+	listDigest := registry.addList(t, "multi", manifest.DockerV2ListMediaType, []fakeImage{amd64, arm64}, []string{"linux/amd64", "linux/arm64/v8"}, "list")
+	repo := "docker://" + registry.host() + "/multi"
+	sha512Of := func(d digest.Digest) digest.Digest {
+		return digest.SHA512.FromBytes(registry.manifests[d].body)
+	}
+
+	// A single image
+	out, err := runSkopeo("manifest-digest", "--tls-verify=false", repo+":amd64")
+	require.NoError(t, err)
+	assert.Equal(t, amd64.digest.String()+"\n", out)
+	out, err = runSkopeo("manifest-digest", "--tls-verify=false", "--algorithm", "sha512", repo+":amd64")
+	require.NoError(t, err)
+	assert.Equal(t, sha512Of(amd64.digest).String()+"\n", out)
+
+	// A manifest list
+	out, err = runSkopeo("manifest-digest", "--tls-verify=false", repo+":list")
+	require.NoError(t, err)
+	assert.Equal(t, listDigest.String()+"\n", out)
+	out, err = runSkopeo("manifest-digest", "--tls-verify=false", "--instances", repo+":list")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s\n%s linux/amd64\n%s linux/arm64/v8\n", listDigest, amd64.digest, arm64.digest), out)
+	out, err = runSkopeo("manifest-digest", "--tls-verify=false", "--algorithm", "sha512", "--instances", repo+":list")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s\n%s linux/amd64\n%s linux/arm64/v8\n", sha512Of(listDigest), sha512Of(amd64.digest), sha512Of(arm64.digest)), out)
+
+	// A manifest list in a file
+	tmpDir, err := ioutil.TempDir("", "skopeo-manifest-digest")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	listFile := filepath.Join(tmpDir, "list.json")
+	err = ioutil.WriteFile(listFile, registry.manifests[listDigest].body, 0644)
+	require.NoError(t, err)
+	out, err = runSkopeo("manifest-digest", listFile)
+	require.NoError(t, err)
+	assert.Equal(t, listDigest.String()+"\n", out)
+	out, err = runSkopeo("manifest-digest", "--algorithm", "sha512", listFile)
+	require.NoError(t, err)
+	assert.Equal(t, sha512Of(listDigest).String()+"\n", out)
+	out, err = runSkopeo("manifest-digest", "--instances", listFile)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%s\n%s linux/amd64\n%s linux/arm64/v8\n", listDigest, amd64.digest, arm64.digest), out)
+	out, err = runSkopeo("manifest-digest", "--algorithm", "sha512", "--instances", listFile)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "requires an image name")
+
+	// sha512 references are verified by the docker transport
+	out, err = runSkopeo("inspect", "--tls-verify=false", "--raw", repo+"@"+sha512Of(amd64.digest).String())
+	require.NoError(t, err)
+	assert.Equal(t, string(registry.manifests[amd64.digest].body), out)
+	out, err = runSkopeo("--insecure-policy", "copy", "--src-tls-verify=false", "--dest-tls-verify=false", repo+":amd64", repo+"@"+sha512Of(arm64.digest).String())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "would not match destination reference")
+}
+
+func TestManifestList(t *testing.T) {
+	registry := newFakeRegistry()
+	defer registry.Close()
+	now := time.Now()
+	amd64 := registry.addImage(t, "app", now, "linux", "amd64", "amd64", "amd64")
+	arm64 := registry.addImage(t, "app", now, "linux", "arm64", "arm64", "arm64")
+	registry.addList(t, "app", manifest.DockerV2ListMediaType, []fakeImage{amd64}, []string{"linux/amd64"}, "existing-list")
+	repo := "docker://" + registry.host() + "/app"
+
+	tmpDir, err := ioutil.TempDir("", "skopeo-manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	readList := func(path string) *editableList {
+		blob, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		list, err := parseEditableList(blob)
+		require.NoError(t, err)
+		return list
+	}
+
+	// A Docker manifest list in a file
+	listFile := filepath.Join(tmpDir, "list.json")
+	out, err := runSkopeo("manifest", "create", "--tls-verify=false", listFile, repo+":amd64", repo+":arm64")
+	require.NoError(t, err)
+	assert.Equal(t, "", out)
+	list := readList(listFile)
+	require.NotNil(t, list.docker)
+	assert.Equal(t, manifest.DockerV2ListMediaType, list.docker.MediaType)
+	require.Len(t, list.docker.Manifests, 2)
+	assert.Equal(t, []digest.Digest{amd64.digest, arm64.digest}, list.instances())
+	assert.Equal(t, manifest.DockerV2Schema2MediaType, list.docker.Manifests[0].MediaType)
+	assert.Equal(t, int64(len(registry.manifests[amd64.digest].body)), list.docker.Manifests[0].Size)
+	assert.Equal(t, manifest.Schema2PlatformSpec{OS: "linux", Architecture: "amd64"}, list.docker.Manifests[0].Platform)
+	assert.Equal(t, manifest.Schema2PlatformSpec{OS: "linux", Architecture: "arm64"}, list.docker.Manifests[1].Platform)
+
+	out, err = runSkopeo("manifest", "annotate", "--variant", "v8", "--os-features", "f1", "--features", "sse4", listFile, arm64.digest.String())
+	require.NoError(t, err)
+	assert.Equal(t, "", out)
+	out, err = runSkopeo("manifest", "add", "--tls-verify=false", "--os-version", "1.0", listFile, repo+":amd64")
+	require.NoError(t, err)
+	assert.Equal(t, amd64.digest.String()+"\n", out)
+	list = readList(listFile)
+	assert.Equal(t, []digest.Digest{amd64.digest, arm64.digest}, list.instances())
+	assert.Equal(t, manifest.Schema2PlatformSpec{OS: "linux", Architecture: "amd64", OSVersion: "1.0"}, list.docker.Manifests[0].Platform)
+	assert.Equal(t, manifest.Schema2PlatformSpec{OS: "linux", Architecture: "arm64", Variant: "v8", OSFeatures: []string{"f1"}, Features: []string{"sse4"}},
+		list.docker.Manifests[1].Platform)
+
+	out, err = runSkopeo("manifest", "push", "--tls-verify=false", listFile, repo+":multi")
+	require.NoError(t, err)
+	contents, err := ioutil.ReadFile(listFile)
+	require.NoError(t, err)
+	listDigest := digest.FromBytes(contents)
+	assert.Equal(t, listDigest.String()+"\n", out)
+	assert.Equal(t, fakeManifest{mimeType: manifest.DockerV2ListMediaType, body: contents}, registry.manifests[listDigest])
+	assert.Equal(t, listDigest, registry.tags["app"]["multi"])
+
+	// The referenced images must exist in the destination
+	registry2 := newFakeRegistry()
+	defer registry2.Close()
+	registry2.addImage(t, "app", now, "linux", "amd64", "amd64", "amd64")
+	out, err = runSkopeo("manifest", "push", "--tls-verify=false", listFile, "docker://"+registry2.host()+"/app:multi")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not available")
+	assert.NotContains(t, err.Error(), amd64.digest.String())
+	assert.Contains(t, err.Error(), arm64.digest.String())
+	_, ok := registry2.tags["app"]["multi"]
+	assert.False(t, ok)
+
+	// An OCI image index in an OCI layout
+	layoutDir := filepath.Join(tmpDir, "layout")
+	ociImages := map[string]digest.Digest{}
+	for _, arch := range []string{"amd64", "arm64"} {
+		_, err = runSkopeo("--insecure-policy", "copy", "--src-tls-verify=false", repo+":"+arch, "oci:"+layoutDir+":"+arch)
+		require.NoError(t, err)
+		out, err = runSkopeo("manifest-digest", "oci:"+layoutDir+":"+arch)
+		require.NoError(t, err)
+		ociImages[arch] = digest.Digest(out[:len(out)-1])
+	}
+	index := "oci:" + layoutDir + ":list"
+	out, err = runSkopeo("manifest", "create", "--format", "oci", "--annotation", "org.example.list=1", index, "oci:"+layoutDir+":amd64")
+	require.NoError(t, err)
+	assert.Equal(t, "", out)
+	out, err = runSkopeo("manifest", "add", "--variant", "v8", "--annotation", "org.example.image=arm64", index, "oci:"+layoutDir+":arm64")
+	require.NoError(t, err)
+	assert.Equal(t, ociImages["arm64"].String()+"\n", out)
+	list, err = readEditableList(context.Background(), nil, index)
+	require.NoError(t, err)
+	require.NotNil(t, list.oci)
+	assert.Equal(t, map[string]string{"org.example.list": "1"}, list.oci.Annotations)
+	require.Len(t, list.oci.Manifests, 2)
+	assert.Equal(t, []digest.Digest{ociImages["amd64"], ociImages["arm64"]}, list.instances())
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, list.oci.Manifests[0].MediaType)
+	assert.Equal(t, &imgspecv1.Platform{OS: "linux", Architecture: "amd64"}, list.oci.Manifests[0].Platform)
+	assert.Nil(t, list.oci.Manifests[0].Annotations)
+	assert.Equal(t, &imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, list.oci.Manifests[1].Platform)
+	assert.Equal(t, map[string]string{"org.example.image": "arm64"}, list.oci.Manifests[1].Annotations)
+	layoutIndex, err := ioutil.ReadFile(filepath.Join(layoutDir, "index.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(layoutIndex), imgspecv1.MediaTypeImageIndex)
+
+	// An empty OCI image index is recorded as an index, not as an image for the current platform.
+	emptyIndex := "oci:" + layoutDir + ":empty"
+	out, err = runSkopeo("manifest", "create", "--format", "oci", emptyIndex)
+	require.NoError(t, err)
+	assert.Equal(t, "", out)
+	layoutIndex, err = ioutil.ReadFile(filepath.Join(layoutDir, "index.json"))
+	require.NoError(t, err)
+	var parsedLayoutIndex imgspecv1.Index
+	err = json.Unmarshal(layoutIndex, &parsedLayoutIndex)
+	require.NoError(t, err)
+	var emptyDescriptor *imgspecv1.Descriptor
+	for i := range parsedLayoutIndex.Manifests {
+		if parsedLayoutIndex.Manifests[i].Annotations["org.opencontainers.image.ref.name"] == "empty" {
+			emptyDescriptor = &parsedLayoutIndex.Manifests[i]
+		}
+	}
+	require.NotNil(t, emptyDescriptor)
+	assert.Equal(t, imgspecv1.MediaTypeImageIndex, emptyDescriptor.MediaType)
+	assert.Nil(t, emptyDescriptor.Platform)
+	out, err = runSkopeo("manifest", "add", emptyIndex, "oci:"+layoutDir+":amd64")
+	require.NoError(t, err)
+	assert.Equal(t, ociImages["amd64"].String()+"\n", out)
+	list, err = readEditableList(context.Background(), nil, emptyIndex)
+	require.NoError(t, err)
+	require.NotNil(t, list.oci)
+	assert.Equal(t, []digest.Digest{ociImages["amd64"]}, list.instances())
+
+	for _, arch := range []string{"amd64", "arm64"} {
+		_, err = runSkopeo("--insecure-policy", "copy", "--dest-tls-verify=false", "oci:"+layoutDir+":"+arch, "docker://"+registry.host()+"/oci:"+arch)
+		require.NoError(t, err)
+	}
+	out, err = runSkopeo("manifest", "push", "--tls-verify=false", index, "docker://"+registry.host()+"/oci:list")
+	require.NoError(t, err)
+	indexDigest := digest.Digest(out[:len(out)-1])
+	assert.Equal(t, imgspecv1.MediaTypeImageIndex, registry.manifests[indexDigest].mimeType)
+	assert.Equal(t, indexDigest, registry.tags["oci"]["list"])
+
+	// Invalid arguments
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"create"}, "Usage"},
+		{[]string{"create", listFile}, "already exists"},
+		{[]string{"create", "--format", "oci", index}, "already exists"},
+		{[]string{"create", "--format", "v2s1", filepath.Join(tmpDir, "new.json")}, "unknown format"},
+		{[]string{"create", "--annotation", "a=b", filepath.Join(tmpDir, "new.json")}, "only supported in OCI image indexes"},
+		{[]string{"create", "--format", "oci", "--annotation", "invalid", filepath.Join(tmpDir, "new.json")}, "Invalid annotation"},
+		{[]string{"create", "dir:" + tmpDir}, "Manifest lists can only be stored in files or in oci: layouts"},
+		{[]string{"create", "oci:" + layoutDir + ":docker"}, "Docker manifest lists can not be stored in oci: layouts"},
+		{[]string{"add", listFile}, "Usage"},
+		{[]string{"add", "--tls-verify=false", listFile, repo + ":existing-list"}, "is a manifest list"},
+		{[]string{"add", index, "oci:" + layoutDir + ":list"}, "is a manifest list"},
+		{[]string{"add", "--tls-verify=false", index, repo + ":amd64"}, "can not be included in an OCI image index"},
+		{[]string{"add", "--tls-verify=false", listFile, "oci:" + layoutDir + ":amd64"}, "can not be included in a Docker manifest list"},
+		{[]string{"add", filepath.Join(tmpDir, "missing.json"), "oci:" + layoutDir + ":amd64"}, "Error reading manifest list"},
+		{[]string{"annotate", listFile}, "Usage"},
+		{[]string{"annotate", listFile, "sha256:invalid"}, "Invalid digest"},
+		{[]string{"annotate", listFile, ociImages["amd64"].String()}, "not found in manifest list"},
+		{[]string{"annotate", "--annotation", "a=b", listFile, amd64.digest.String()}, "only supported in OCI image indexes"},
+		{[]string{"annotate", "--features", "sse4", index, ociImages["amd64"].String()}, "only supported in Docker manifest lists"},
+		{[]string{"annotate", "fixtures/image.manifest.json", amd64.digest.String()}, "Not a Docker manifest list or an OCI image index"},
+		{[]string{"push", listFile}, "Usage"},
+		{[]string{"push", listFile, "dir:" + tmpDir}, "Only docker:// destinations are supported"},
+	} {
+		out, err := runSkopeo(append([]string{"manifest"}, c.args...)...)
+		assertTestFailed(t, out, err, c.expected)
+	}
 }
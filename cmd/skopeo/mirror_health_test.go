@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRegistry returns a plain-HTTP registry serving manifest as busybox:latest.
+func newTestRegistry(manifest []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/busybox/manifests/latest":
+			w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+			w.Write(manifest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestMirrorHealth(t *testing.T) {
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	primary := newTestRegistry(manifest)
+	defer primary.Close()
+	primaryHost := strings.TrimPrefix(primary.URL, "http://")
+	mirror := newTestRegistry(manifest)
+	defer mirror.Close()
+	mirrorHost := strings.TrimPrefix(mirror.URL, "http://")
+	const deadMirrorHost = "127.0.0.1:1" // Nothing listens there
+
+	dir, err := ioutil.TempDir("", "skopeo-mirror-health")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// Store the mirror health state in dir instead of the system-wide location.
+	for name, value := range map[string]string{"_CONTAINERS_ROOTLESS_UID": "1000", "XDG_DATA_HOME": dir} {
+		oldValue, wasSet := os.LookupEnv(name)
+		os.Setenv(name, value)
+		if wasSet {
+			defer os.Setenv(name, oldValue)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+	statePath := filepath.Join(dir, "containers", "cache", "docker-mirror-health-v1.json")
+
+	log := bytes.Buffer{}
+	logrus.SetOutput(&log)
+	defer logrus.SetOutput(os.Stderr)
+	defer logrus.SetLevel(logrus.GetLevel())
+
+	inspect := func(mirrors ...string) {
+		conf := fmt.Sprintf("[[registry]]\nlocation = \"%s\"\ninsecure = true\n", primaryHost)
+		for _, m := range mirrors {
+			conf += fmt.Sprintf("[[registry.mirror]]\nlocation = \"%s\"\ninsecure = true\n", m)
+		}
+		log.Reset()
+		out, err := runSkopeo("--debug", "--registries-conf", writeRegistriesConf(t, dir, conf),
+			"inspect", "--raw", "docker://"+primaryHost+"/busybox:latest")
+		require.NoError(t, err)
+		assert.Equal(t, string(manifest), out)
+	}
+
+	// A healthy mirror serves the image.
+	inspect(mirrorHost)
+	assert.Contains(t, log.String(), fmt.Sprintf(`from mirror "%s/busybox:latest"`, mirrorHost))
+	_, err = os.Stat(statePath)
+	assert.True(t, os.IsNotExist(err))
+
+	// A dead mirror falls through to the primary location, and is recorded.
+	inspect(deadMirrorHost)
+	assert.Contains(t, log.String(), fmt.Sprintf("Mirror %s could not be contacted", deadMirrorHost))
+	assert.Contains(t, log.String(), fmt.Sprintf(`from the primary location "%s/busybox:latest"`, primaryHost))
+	state, err := ioutil.ReadFile(statePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(state), deadMirrorHost)
+
+	// The dead mirror is now tried only after the primary location, so it is not contacted at all.
+	inspect(deadMirrorHost, mirrorHost)
+	assert.Contains(t, log.String(), fmt.Sprintf("Mirror %s could not be contacted at", deadMirrorHost))
+	assert.NotContains(t, log.String(), fmt.Sprintf(`Trying to pull "%s/busybox:latest"`, deadMirrorHost))
+	assert.Contains(t, log.String(), fmt.Sprintf(`from mirror "%s/busybox:latest"`, mirrorHost))
+}
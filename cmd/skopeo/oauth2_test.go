@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOAuth2IdentityToken(t *testing.T) {
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+
+	var tokenRequests []string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if r.Method != http.MethodPost {
+				tokenRequests = append(tokenRequests, r.Method)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if err := r.ParseForm(); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			tokenRequests = append(tokenRequests, fmt.Sprintf("%s %s %s %s", r.Method, r.PostForm.Get("grant_type"),
+				r.PostForm.Get("service"), r.PostForm.Get("scope")))
+			if r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("refresh_token") != "refresh-me" ||
+				r.PostForm.Get("client_id") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token":  "oauth2-token",
+				"expires_in":    300,
+				"refresh_token": "refresh-me",
+			})
+		case r.Header.Get("Authorization") != "Bearer oauth2-token" && r.Header.Get("Authorization") != "Bearer given-token":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/v2/busybox/manifests/latest":
+			w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+			w.Write(manifest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "http://")
+	image := "docker://" + registry + "/busybox:latest"
+
+	dir, err := ioutil.TempDir("", "skopeo-oauth2")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer setEnv("HOME", dir)() // Don't use the user's .docker/config.json
+	authFile := filepath.Join(dir, "auth.json")
+	err = ioutil.WriteFile(authFile, []byte(fmt.Sprintf(`{"auths":{"%s":{"identitytoken":"refresh-me"}}}`, registry)), 0600)
+	require.NoError(t, err)
+
+	// The identity token is exchanged for a bearer token using a POST request.
+	out, err := runSkopeo("inspect", "--tls-verify=false", "--raw", "--authfile", authFile, image)
+	require.NoError(t, err)
+	assert.Equal(t, string(manifest), out)
+	require.NotEmpty(t, tokenRequests)
+	assert.Equal(t, "POST refresh_token test repository:busybox:pull", tokenRequests[len(tokenRequests)-1])
+
+	// A pre-obtained token is used directly, without contacting the token server.
+	tokenRequests = nil
+	out, err = runSkopeo("inspect", "--tls-verify=false", "--raw", "--registry-token", "given-token", image)
+	require.NoError(t, err)
+	assert.Equal(t, string(manifest), out)
+	assert.Empty(t, tokenRequests)
+
+	out, err = runSkopeo("inspect", "--tls-verify=false", "--raw", "--registry-token", "wrong-token", image)
+	assertTestFailed(t, out, err, "unauthorized")
+
+	out, err = runSkopeo("inspect", "--tls-verify=false", "--raw", "--registry-token", "given-token", "--creds", "user:pass", image)
+	assertTestFailed(t, out, err, "registry-token can not be specified together with creds")
+}
+
+func TestRegistryTokenNotSentToMirrors(t *testing.T) {
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	primary := newTestRegistry(manifest)
+	defer primary.Close()
+	primaryHost := strings.TrimPrefix(primary.URL, "http://")
+	var mirrorAuthorization []string
+	var mirror *httptest.Server
+	mirror = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		mirrorAuthorization = append(mirrorAuthorization, auth)
+		switch {
+		case r.URL.Path == "/token":
+			json.NewEncoder(w).Encode(map[string]interface{}{"token": "mirror-token"})
+		case auth != "Bearer mirror-token":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, mirror.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			primary.Config.Handler.ServeHTTP(w, r)
+		}
+	}))
+	defer mirror.Close()
+	mirrorHost := strings.TrimPrefix(mirror.URL, "http://")
+
+	dir, err := ioutil.TempDir("", "skopeo-registry-token-mirror")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer setEnv("HOME", dir)() // Don't use the user's .docker/config.json
+	conf := fmt.Sprintf("[[registry]]\nlocation = \"%s\"\ninsecure = true\n"+
+		"[[registry.mirror]]\nlocation = \"%s\"\ninsecure = true\n", primaryHost, mirrorHost)
+
+	out, err := runSkopeo("--registries-conf", writeRegistriesConf(t, dir, conf),
+		"inspect", "--raw", "--registry-token", "given-token", "docker://"+primaryHost+"/busybox:latest")
+	require.NoError(t, err)
+	assert.Equal(t, string(manifest), out)
+	// The mirror is accessed using its own token, never using the one intended for the primary registry.
+	assert.Contains(t, mirrorAuthorization, "Bearer mirror-token")
+	assert.NotContains(t, mirrorAuthorization, "Bearer given-token")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containers/image/docker"
+	"github.com/containers/image/types"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+func registriesDCmd(global *globalOptions) cli.Command {
+	return cli.Command{
+		Name:  "registries-d",
+		Usage: "Work with registries.d configuration",
+		Subcommands: []cli.Command{
+			registriesDCheckCmd(global),
+		},
+	}
+}
+
+type registriesDCheckOptions struct {
+	global *globalOptions
+}
+
+func registriesDCheckCmd(global *globalOptions) cli.Command {
+	opts := registriesDCheckOptions{global: global}
+	return cli.Command{
+		Name:  "check",
+		Usage: "Check registries.d configuration, and show signature storage used for IMAGE-NAME",
+		Description: `
+	Load and validate the registries.d configuration.  If "IMAGE-NAME" is specified,
+	show the signature storage locations used for it; otherwise, check the locations
+	configured for all namespaces.
+
+	"IMAGE-NAME" is a docker:// image reference; the docker:// prefix is optional.
+	`,
+		ArgsUsage: "[IMAGE-NAME]",
+		Action:    commandAction(opts.run),
+	}
+}
+
+// registriesDCheckOutput is the output format of (skopeo registries-d check IMAGE-NAME).
+type registriesDCheckOutput struct {
+	SigStore        *docker.SignatureStorageLocation // Used for reading signatures
+	SigStoreStaging *docker.SignatureStorageLocation // Used for writing signatures
+}
+
+func (opts *registriesDCheckOptions) run(args []string, stdout io.Writer) error {
+	if len(args) > 1 {
+		return errors.New("Usage: skopeo registries-d check [IMAGE-NAME]")
+	}
+	sys := &types.SystemContext{RegistriesDirPath: opts.global.registriesDirPath}
+
+	if len(args) == 0 {
+		if err := docker.CheckRegistryConfiguration(sys); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, "The registries.d configuration is valid")
+		return nil
+	}
+
+	imageName := strings.TrimPrefix(args[0], docker.Transport.Name()+":")
+	if !strings.HasPrefix(imageName, "//") {
+		imageName = "//" + imageName
+	}
+	ref, err := docker.ParseReference(imageName)
+	if err != nil {
+		return fmt.Errorf("Invalid image name %s: %v", args[0], err)
+	}
+	read, write, err := docker.ConfiguredSignatureStorage(sys, ref)
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(registriesDCheckOutput{SigStore: read, SigStoreStaging: write}, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, string(out))
+	return nil
+}
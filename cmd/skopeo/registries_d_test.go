@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/docker"
+	"github.com/containers/image/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memSignatureStorage is a docker.SignatureStorage keeping signatures in memory.
+type memSignatureStorage struct {
+	mu         sync.Mutex
+	signatures map[string][]byte
+}
+
+func (m *memSignatureStorage) GetSignature(ctx context.Context, sys *types.SystemContext, url *url.URL) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sig, ok := m.signatures[url.String()]
+	return sig, !ok, nil
+}
+
+func (m *memSignatureStorage) PutSignature(ctx context.Context, sys *types.SystemContext, url *url.URL, signature []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.signatures[url.String()] = signature
+	return nil
+}
+
+func (m *memSignatureStorage) DeleteSignature(ctx context.Context, sys *types.SystemContext, url *url.URL) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.signatures[url.String()]
+	delete(m.signatures, url.String())
+	return !ok, nil
+}
+
+var testMemSignatureStorage = &memSignatureStorage{signatures: map[string][]byte{}}
+
+func init() {
+	docker.RegisterSignatureStorage("test-mem", testMemSignatureStorage)
+}
+
+// writeRegistriesD creates a registries.d directory in a temporary directory, containing files with the specified contents.
+func writeRegistriesD(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "skopeo-registries.d")
+	require.NoError(t, err)
+	for name, contents := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		require.NoError(t, err)
+	}
+	return dir
+}
+
+func TestRegistriesDCheck(t *testing.T) {
+	dir := writeRegistriesD(t, map[string]string{
+		"default.yaml": "default-docker:\n  sigstore: https://sigstore.example.com\n",
+		"example.yaml": "docker:\n" +
+			"  registry.example.com:\n" +
+			"    sigstore: https://registry.example.com/sigstore\n" +
+			"    sigstore-staging: file:///srv/sigstore-staging\n" +
+			"  registry.example.com/mem:\n" +
+			"    sigstore: test-mem://store\n",
+		"ignored.txt": "this is not YAML",
+	})
+	defer os.RemoveAll(dir)
+
+	out, err := runSkopeo("--registries.d", dir, "registries-d", "check")
+	require.NoError(t, err)
+	assert.Equal(t, "The registries.d configuration is valid\n", out)
+
+	for _, c := range []struct {
+		image                           string
+		sigstore, sigstoreNS            string
+		sigstoreStaging, sigstoreStagNS string
+		sigstorePath, stagingPath       string
+	}{
+		{"docker://busybox", "https://sigstore.example.com/library/busybox", "", "https://sigstore.example.com/library/busybox", "", "default.yaml", "default.yaml"},
+		{"registry.example.com/ns/repo:tag", "https://registry.example.com/sigstore/ns/repo", "registry.example.com",
+			"file:///srv/sigstore-staging/ns/repo", "registry.example.com", "example.yaml", "example.yaml"},
+		{"registry.example.com/mem/repo", "test-mem://store/mem/repo", "registry.example.com/mem",
+			"test-mem://store/mem/repo", "registry.example.com/mem", "example.yaml", "example.yaml"},
+	} {
+		out, err := runSkopeo("--registries.d", dir, "registries-d", "check", c.image)
+		require.NoError(t, err, c.image)
+		var res map[string]map[string]string
+		err = json.Unmarshal([]byte(out), &res)
+		require.NoError(t, err, c.image)
+		assert.Equal(t, map[string]map[string]string{
+			"SigStore":        {"URL": c.sigstore, "Namespace": c.sigstoreNS, "ConfigPath": filepath.Join(dir, c.sigstorePath)},
+			"SigStoreStaging": {"URL": c.sigstoreStaging, "Namespace": c.sigstoreStagNS, "ConfigPath": filepath.Join(dir, c.stagingPath)},
+		}, res, c.image)
+	}
+
+	// No signature storage configured
+	empty := writeRegistriesD(t, map[string]string{})
+	defer os.RemoveAll(empty)
+	out, err = runSkopeo("--registries.d", empty, "registries-d", "check", "busybox")
+	require.NoError(t, err)
+	assert.Equal(t, "{\n    \"SigStore\": null,\n    \"SigStoreStaging\": null\n}\n", out)
+
+	// Invalid command-line arguments
+	out, err = runSkopeo("--registries.d", dir, "registries-d", "check", "a1", "a2")
+	assertTestFailed(t, out, err, "Usage")
+	out, err = runSkopeo("--registries.d", dir, "registries-d", "check", "docker://UPPERCASE")
+	assertTestFailed(t, out, err, "Invalid image name")
+
+	// Invalid configuration
+	for _, c := range []struct{ contents, expected string }{
+		{"docker: [", "Error parsing"},
+		{"docker:\n  docker://busybox:\n    sigstore: https://example.com\n", `Invalid "docker" namespace`},
+		{"docker:\n  busybox:\n    sigstore: relative/path\n", "Missing URL scheme"},
+		{"docker:\n  busybox:\n    sigstore: file://relative/path\n", "absolute path"},
+		{"default-docker:\n  sigstore-staging: https:///path\n", "Missing host name"},
+		{"default-docker:\n  sigstore: unknown://host/path\n", "Unsupported signature storage URL scheme"},
+	} {
+		invalid := writeRegistriesD(t, map[string]string{"invalid.yaml": c.contents})
+		defer os.RemoveAll(invalid)
+		out, err := runSkopeo("--registries.d", invalid, "registries-d", "check")
+		assertTestFailed(t, out, err, c.expected)
+		assert.Contains(t, err.Error(), filepath.Join(invalid, "invalid.yaml"))
+	}
+
+	// An unsupported URL scheme is only an error for the namespaces which use it.
+	unknown := writeRegistriesD(t, map[string]string{
+		"default.yaml": "default-docker:\n  sigstore: https://sigstore.example.com\n",
+		"unknown.yaml": "docker:\n  registry.example.com/unknown:\n    sigstore-staging: unknown://host/path\n",
+	})
+	defer os.RemoveAll(unknown)
+	out, err = runSkopeo("--registries.d", unknown, "registries-d", "check", "busybox")
+	require.NoError(t, err)
+	assert.Contains(t, out, "https://sigstore.example.com/library/busybox")
+	out, err = runSkopeo("--registries.d", unknown, "registries-d", "check", "registry.example.com/unknown/repo")
+	assertTestFailed(t, out, err, "Unsupported signature storage URL scheme")
+	assert.Contains(t, err.Error(), filepath.Join(unknown, "unknown.yaml"))
+	out, err = runSkopeo("--registries.d", unknown, "registries-d", "check")
+	assertTestFailed(t, out, err, "Unsupported signature storage URL scheme")
+	assert.Contains(t, err.Error(), "registry.example.com/unknown")
+	assert.Contains(t, err.Error(), filepath.Join(unknown, "unknown.yaml"))
+}
+
+func TestRegisteredSignatureStorage(t *testing.T) {
+	os.Setenv("GNUPGHOME", "fixtures")
+	defer os.Unsetenv("GNUPGHOME")
+
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	server := newTestRegistry(manifest)
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	dir := writeRegistriesD(t, map[string]string{
+		"mem.yaml": fmt.Sprintf("docker:\n  %s:\n    sigstore: test-mem://store\n", registry),
+	})
+	defer os.RemoveAll(dir)
+
+	sig, err := ioutil.ReadFile("fixtures/image.signature")
+	require.NoError(t, err)
+	sigURL, err := url.Parse(fmt.Sprintf("test-mem://store/busybox@%s=%s/signature-1",
+		fixturesTestImageManifestDigest.Algorithm(), fixturesTestImageManifestDigest.Hex()))
+	require.NoError(t, err)
+	err = testMemSignatureStorage.PutSignature(context.Background(), nil, sigURL, sig)
+	require.NoError(t, err)
+	defer testMemSignatureStorage.DeleteSignature(context.Background(), nil, sigURL)
+
+	out, err := runSkopeo("--registries.d", dir, "signatures", "list", "--tls-verify=false", "docker://"+registry+"/busybox:latest")
+	require.NoError(t, err)
+	var res []map[string]interface{}
+	err = json.Unmarshal([]byte(out), &res)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, true, res[0]["Verified"])
+	assert.Equal(t, fixturesTestKeyFingerprint, res[0]["KeyFingerprint"])
+}
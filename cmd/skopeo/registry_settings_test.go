@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRegistriesConf writes contents to a new registries.conf file in dir, and returns its path.
+// (A new file is necessary for every configuration because the parsed files are cached.)
+func writeRegistriesConf(t *testing.T, dir, contents string) string {
+	f, err := ioutil.TempFile(dir, "registries.conf")
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString(contents)
+	require.NoError(t, err)
+	return f.Name()
+}
+
+func TestRegistrySettings(t *testing.T) {
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Gateway-Key") != "secret" || !strings.HasSuffix(r.Header.Get("User-Agent"), "gateway-client/1.0") {
+			http.Error(w, "missing gateway headers", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/busybox/manifests/latest":
+			w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+			w.Write(manifest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	dir, err := ioutil.TempDir("", "skopeo-registry-settings")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	caPath := filepath.Join(dir, "ca.pem")
+	err = ioutil.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+	require.NoError(t, err)
+
+	// The CA bundle and headers are applied.
+	conf := writeRegistriesConf(t, dir, fmt.Sprintf(`
+[[registry]]
+location = "%s"
+ca-certificates = "%s"
+user-agent-suffix = "gateway-client/1.0"
+connect-timeout = "5s"
+response-timeout = "5s"
+[registry.headers]
+X-Gateway-Key = "secret"
+`, registry, caPath))
+	out, err := runSkopeo("--registries-conf", conf, "inspect", "--raw", "docker://"+registry+"/busybox:latest")
+	require.NoError(t, err)
+	assert.Equal(t, string(manifest), out)
+
+	// Without the CA bundle, the server is not trusted.
+	conf = writeRegistriesConf(t, dir, fmt.Sprintf(`
+[[registry]]
+location = "%s"
+[registry.headers]
+X-Gateway-Key = "secret"
+`, registry))
+	out, err = runSkopeo("--registries-conf", conf, "inspect", "--raw", "docker://"+registry+"/busybox:latest")
+	assertTestFailed(t, out, err, "certificate")
+
+	// Without the headers, the request is rejected.
+	conf = writeRegistriesConf(t, dir, fmt.Sprintf(`
+[[registry]]
+location = "%s"
+ca-certificates = "%s"
+`, registry, caPath))
+	out, err = runSkopeo("--registries-conf", conf, "inspect", "--raw", "docker://"+registry+"/busybox:latest")
+	assertTestFailed(t, out, err, "403")
+
+	// Invalid settings are rejected.
+	for _, c := range []struct{ settings, expected string }{
+		{`client-certificate = "/dev/null"`, "must set both 'client-certificate' and 'client-key'"},
+		{`http-proxy = "not a URL"`, "invalid 'http-proxy' URL"},
+		{`connect-timeout = "soon"`, "invalid duration"},
+	} {
+		conf = writeRegistriesConf(t, dir, fmt.Sprintf("[[registry]]\nlocation = \"%s\"\n%s\n", registry, c.settings))
+		out, err = runSkopeo("--registries-conf", conf, "inspect", "--raw", "docker://"+registry+"/busybox:latest")
+		assertTestFailed(t, out, err, c.expected)
+	}
+}
+
+// writeClientCertificate writes a new self-signed client certificate and its private key to dir, and returns their paths.
+func writeClientCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "skopeo-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certPath, keyPath := filepath.Join(dir, "client.cert"), filepath.Join(dir, "client.key")
+	err = ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0644)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600)
+	require.NoError(t, err)
+	return certPath, keyPath
+}
+
+func TestRegistrySettingsOtherHosts(t *testing.T) {
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+
+	// The token server may be operated by a third party, so it must receive neither the client certificate
+	// nor the gateway headers of the registry.
+	tokenServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Gateway-Key") != "" {
+			http.Error(w, "unexpected gateway headers", http.StatusBadRequest)
+			return
+		}
+		if len(r.TLS.PeerCertificates) != 0 {
+			http.Error(w, "unexpected client certificate", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"token":"registry-token"}`))
+	}))
+	tokenServer.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	tokenServer.StartTLS()
+	defer tokenServer.Close()
+	// The storage server receives redirected manifest requests, and must not receive the gateway headers.
+	storageServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Gateway-Key") != "" {
+			http.Error(w, "unexpected gateway headers", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+		w.Write(manifest)
+	}))
+	defer storageServer.Close()
+	// The registry requires the client certificate.
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Gateway-Key") != "secret" {
+			http.Error(w, "missing gateway headers", http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer registry-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, tokenServer.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/busybox/manifests/latest":
+			http.Redirect(w, r, storageServer.URL+"/busybox/manifest", http.StatusTemporaryRedirect)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0) // Don't log the expected handshake failures
+	server.StartTLS()
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	dir, err := ioutil.TempDir("", "skopeo-registry-settings")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// All httptest servers use the same certificate.
+	caPath := filepath.Join(dir, "ca.pem")
+	err = ioutil.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+	require.NoError(t, err)
+	certPath, keyPath := writeClientCertificate(t, dir)
+
+	conf := writeRegistriesConf(t, dir, fmt.Sprintf(`
+[[registry]]
+location = "%s"
+ca-certificates = "%s"
+client-certificate = "%s"
+client-key = "%s"
+[registry.headers]
+X-Gateway-Key = "secret"
+`, registry, caPath, certPath, keyPath))
+	out, err := runSkopeo("--registries-conf", conf, "inspect", "--raw", "docker://"+registry+"/busybox:latest")
+	require.NoError(t, err)
+	assert.Equal(t, string(manifest), out)
+
+	// Without the CA certificates, neither the registry nor the token server are trusted…
+	conf = writeRegistriesConf(t, dir, fmt.Sprintf(`
+[[registry]]
+location = "%s"
+client-certificate = "%s"
+client-key = "%s"
+[registry.headers]
+X-Gateway-Key = "secret"
+`, registry, certPath, keyPath))
+	out, err = runSkopeo("--registries-conf", conf, "inspect", "--raw", "docker://"+registry+"/busybox:latest")
+	assertTestFailed(t, out, err, "certificate")
+
+	// … unless the registry is insecure.
+	conf = writeRegistriesConf(t, dir, fmt.Sprintf(`
+[[registry]]
+location = "%s"
+insecure = true
+client-certificate = "%s"
+client-key = "%s"
+[registry.headers]
+X-Gateway-Key = "secret"
+`, registry, certPath, keyPath))
+	out, err = runSkopeo("--registries-conf", conf, "inspect", "--raw", "docker://"+registry+"/busybox:latest")
+	require.NoError(t, err)
+	assert.Equal(t, string(manifest), out)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containers/image/directory"
+	"github.com/containers/image/docker"
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/openshift"
+	"github.com/containers/image/signature"
+	"github.com/containers/image/storage"
+	"github.com/containers/image/transports"
+	"github.com/containers/image/transports/alltransports"
+	"github.com/containers/image/types"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+type signOptions struct {
+	global            *globalOptions
+	image             *imageOptions
+	signByFingerprint string // Sign the image using a GPG key with the specified fingerprint
+	identity          string // Docker reference to claim in the signature, instead of the one implied by the image name
+}
+
+func signCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageFlags(global, sharedOpts, "", "")
+	opts := signOptions{
+		global: global,
+		image:  imageOpts,
+	}
+	return cli.Command{
+		Name:  "sign",
+		Usage: "Add a signature to IMAGE-NAME",
+		Description: fmt.Sprintf(`
+	Add a signature to "IMAGE-NAME" without copying it, keeping the existing signatures
+
+	Supported transports:
+	%s
+
+	See skopeo(1) section "IMAGE NAMES" for the expected format
+	`, strings.Join(transports.ListNames(), ", ")),
+		ArgsUsage: "IMAGE-NAME",
+		Action:    commandAction(opts.run),
+		Flags: append(append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "sign-by",
+				Usage:       "Sign the image using a GPG key with the specified `FINGERPRINT`",
+				Destination: &opts.signByFingerprint,
+			},
+			cli.StringFlag{
+				Name:        "identity",
+				Usage:       "Sign the image as `DOCKER-REFERENCE` (default is the name of IMAGE-NAME)",
+				Destination: &opts.identity,
+			},
+		}, sharedFlags...), imageFlags...),
+	}
+}
+
+func (opts *signOptions) run(args []string, stdout io.Writer) error {
+	if len(args) != 1 || opts.signByFingerprint == "" {
+		return errors.New("Usage: skopeo sign --sign-by key-fingerprint imageReference")
+	}
+	imageName := args[0]
+
+	if err := reexecIfNecessaryForImages(imageName); err != nil {
+		return err
+	}
+
+	ref, err := alltransports.ParseImageName(imageName)
+	if err != nil {
+		return fmt.Errorf("Invalid image name %s: %v", imageName, err)
+	}
+	if err := checkSignaturesReplaceable(ref); err != nil {
+		return err
+	}
+	identity := opts.identity
+	if identity == "" {
+		dockerRef := ref.DockerReference()
+		if dockerRef == nil {
+			return fmt.Errorf("Cannot determine canonical Docker reference for %s, use --identity", imageName)
+		}
+		identity = dockerRef.String()
+	}
+
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	man, sigs, err := getManifestAndSignatures(ctx, sys, ref)
+	if err != nil {
+		return err
+	}
+
+	mech, err := signature.NewGPGSigningMechanism()
+	if err != nil {
+		return fmt.Errorf("Error initializing GPG: %v", err)
+	}
+	defer mech.Close()
+	newSig, err := signature.SignDockerManifest(man, identity, mech, opts.signByFingerprint)
+	if err != nil {
+		return fmt.Errorf("Error creating signature: %v", err)
+	}
+
+	if err := replaceSignatures(ctx, sys, ref, man, append(sigs, newSig)); err != nil {
+		return fmt.Errorf("Error writing signatures: %v", err)
+	}
+	return nil
+}
+
+// checkSignaturesReplaceable returns an error if replaceSignatures does not support ref.
+func checkSignaturesReplaceable(ref types.ImageReference) error {
+	// Compare transport names: a containers-storage: reference using a non-default store has its own transport object.
+	switch ref.Transport().Name() {
+	case docker.Transport.Name(), directory.Transport.Name(), storage.Transport.Name(), openshift.Transport.Name():
+		return nil
+	default:
+		// Other transports can't store signatures without writing the whole image again,
+		// or don't support signatures at all.
+		return fmt.Errorf("Replacing signatures of %s images is not supported, only docker:, dir:, containers-storage: and atomic: images are supported", ref.Transport().Name())
+	}
+}
+
+// replaceSignatures replaces the signatures of the image at ref, which has the manifest man, with sigs,
+// without modifying the rest of the image.
+func replaceSignatures(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, man []byte, sigs [][]byte) error {
+	switch ref.Transport().Name() {
+	case docker.Transport.Name():
+		manifestDigest, err := manifest.Digest(man)
+		if err != nil {
+			return err
+		}
+		return docker.PutSignatures(ctx, sys, ref, manifestDigest, sigs)
+	case directory.Transport.Name():
+		// A dir: ImageDestination would erase the image.
+		return directory.PutSignatures(ref, sigs)
+	case storage.Transport.Name():
+		// A containers-storage: ImageDestination would have to store the whole image again.
+		return storage.PutSignatures(ref, sigs)
+	case openshift.Transport.Name():
+		manifestDigest, err := manifest.Digest(man)
+		if err != nil {
+			return err
+		}
+		return openshift.PutSignatures(ctx, ref, manifestDigest, sigs)
+	default:
+		return checkSignaturesReplaceable(ref)
+	}
+}
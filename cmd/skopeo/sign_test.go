@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+	mech, _, err := signature.NewEphemeralGPGSigningMechanism([]byte{})
+	require.NoError(t, err)
+	defer mech.Close()
+	if err := mech.SupportsSigning(); err != nil {
+		t.Skipf("Signing not supported: %v", err)
+	}
+
+	dockerReference := "testing/manifest"
+	os.Setenv("GNUPGHOME", "fixtures")
+	defer os.Unsetenv("GNUPGHOME")
+
+	// Invalid command-line arguments
+	for _, args := range [][]string{
+		{},
+		{"a1"},
+		{"--sign-by", fixturesTestKeyFingerprint},
+		{"--sign-by", fixturesTestKeyFingerprint, "a1", "a2"},
+	} {
+		out, err := runSkopeo(append([]string{"sign"}, args...)...)
+		assertTestFailed(t, out, err, "Usage")
+	}
+
+	// Invalid image name
+	out, err := runSkopeo("sign", "--sign-by", fixturesTestKeyFingerprint, "this-is-not-a-transport:foo")
+	assertTestFailed(t, out, err, "Invalid image name")
+
+	dir, err := ioutil.TempDir("", "skopeo-sign")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "version"), []byte("Directory Transport Version: 1.1\n"), 0644)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "manifest.json"), manifest, 0644)
+	require.NoError(t, err)
+
+	// No identity available for dir:
+	out, err = runSkopeo("sign", "--sign-by", fixturesTestKeyFingerprint, "dir:"+dir)
+	assertTestFailed(t, out, err, "--identity")
+
+	// Success, twice; the first signature must be preserved.
+	for i := 0; i < 2; i++ {
+		out, err = runSkopeo("sign", "--sign-by", fixturesTestKeyFingerprint, "--identity", dockerReference, "dir:"+dir)
+		require.NoError(t, err)
+		assert.Empty(t, out)
+	}
+	_, err = os.Stat(filepath.Join(dir, "signature-3"))
+	assert.True(t, os.IsNotExist(err))
+	mech, err = signature.NewGPGSigningMechanism()
+	require.NoError(t, err)
+	defer mech.Close()
+	for _, name := range []string{"signature-1", "signature-2"} {
+		sig, err := ioutil.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		verified, err := signature.VerifyDockerManifestSignature(sig, manifest, dockerReference, mech, fixturesTestKeyFingerprint)
+		require.NoError(t, err, name)
+		assert.Equal(t, dockerReference, verified.DockerReference)
+		assert.Equal(t, fixturesTestImageManifestDigest, verified.DockerManifestDigest)
+	}
+	// The rest of the image is unchanged.
+	m, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, manifest, m)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containers/image/signature"
+	"github.com/containers/image/transports/alltransports"
+	"github.com/containers/image/types"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+func signaturesCmd(global *globalOptions) cli.Command {
+	return cli.Command{
+		Name:  "signatures",
+		Usage: "List or remove signatures of an image",
+		Subcommands: []cli.Command{
+			signaturesListCmd(global),
+			signaturesRemoveCmd(global),
+		},
+	}
+}
+
+type signaturesListOptions struct {
+	global *globalOptions
+	image  *imageOptions
+}
+
+func signaturesListCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageFlags(global, sharedOpts, "", "")
+	opts := signaturesListOptions{
+		global: global,
+		image:  imageOpts,
+	}
+	return cli.Command{
+		Name:  "list",
+		Usage: "List signatures of IMAGE-NAME",
+		Description: `
+	List the signatures of "IMAGE-NAME", verifying each of them using the keys in the default GPG keyring
+
+	See skopeo(1) section "IMAGE NAMES" for the expected format
+	`,
+		ArgsUsage: "IMAGE-NAME",
+		Action:    commandAction(opts.run),
+		Flags:     append(sharedFlags, imageFlags...),
+	}
+}
+
+// signatureListOutput is the output format of (skopeo signatures list).
+// The Untrusted… values are only authenticated if Verified is true; otherwise they may be arbitrarily misleading.
+type signatureListOutput struct {
+	Index             int
+	Verified          bool
+	KeyFingerprint    string `json:",omitempty"` // Only set if Verified
+	VerificationError string `json:",omitempty"`
+	*signature.UntrustedSignatureInformation
+}
+
+func (opts *signaturesListOptions) run(args []string, stdout io.Writer) (retErr error) {
+	if len(args) != 1 {
+		return errors.New("Usage: skopeo signatures list imageReference")
+	}
+	imageName := args[0]
+
+	if err := reexecIfNecessaryForImages(imageName); err != nil {
+		return err
+	}
+
+	ref, err := alltransports.ParseImageName(imageName)
+	if err != nil {
+		return fmt.Errorf("Invalid image name %s: %v", imageName, err)
+	}
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	man, sigs, err := getManifestAndSignatures(ctx, sys, ref)
+	if err != nil {
+		return err
+	}
+
+	mech, err := signature.NewGPGSigningMechanism()
+	if err != nil {
+		return fmt.Errorf("Error initializing GPG: %v", err)
+	}
+	defer mech.Close()
+
+	outputData := []signatureListOutput{}
+	for i, sig := range sigs {
+		outputData = append(outputData, describeSignature(mech, man, i, sig))
+	}
+	out, err := json.MarshalIndent(outputData, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, string(out))
+	return nil
+}
+
+// describeSignature returns information about signature number index of the image with manifest man, verified using mech if possible.
+func describeSignature(mech signature.SigningMechanism, man []byte, index int, sig []byte) signatureListOutput {
+	res := signatureListOutput{Index: index}
+	untrustedInfo, err := signature.GetUntrustedSignatureInformationWithoutVerifying(sig)
+	if err != nil {
+		res.VerificationError = fmt.Sprintf("Error decoding signature: %v", err)
+		return res
+	}
+	res.UntrustedSignatureInformation = untrustedInfo
+
+	_, keyIdentity, err := mech.Verify(sig)
+	if err != nil {
+		res.VerificationError = err.Error()
+		return res
+	}
+	// Verify the signature again, this time also checking that it applies to this manifest.
+	if _, err := signature.VerifyDockerManifestSignature(sig, man, untrustedInfo.UntrustedDockerReference, mech, keyIdentity); err != nil {
+		res.VerificationError = err.Error()
+		return res
+	}
+	res.Verified = true
+	res.KeyFingerprint = keyIdentity
+	return res
+}
+
+type signaturesRemoveOptions struct {
+	global *globalOptions
+	image  *imageOptions
+	keyID  string // Remove signatures made by the key with this key ID or fingerprint
+}
+
+func signaturesRemoveCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageFlags(global, sharedOpts, "", "")
+	opts := signaturesRemoveOptions{
+		global: global,
+		image:  imageOpts,
+	}
+	return cli.Command{
+		Name:  "remove",
+		Usage: "Remove signatures of IMAGE-NAME made by a key",
+		Description: `
+	Remove the signatures of "IMAGE-NAME" made by the specified key, keeping all other signatures
+
+	See skopeo(1) section "IMAGE NAMES" for the expected format
+	`,
+		ArgsUsage: "IMAGE-NAME",
+		Action:    commandAction(opts.run),
+		Flags: append(append([]cli.Flag{
+			cli.StringFlag{
+				Name:        "key-id",
+				Usage:       "Remove signatures made by the key with `KEY-ID` (a 16-digit key ID or a fingerprint)",
+				Destination: &opts.keyID,
+			},
+		}, sharedFlags...), imageFlags...),
+	}
+}
+
+func (opts *signaturesRemoveOptions) run(args []string, stdout io.Writer) (retErr error) {
+	if len(args) != 1 || opts.keyID == "" {
+		return errors.New("Usage: skopeo signatures remove --key-id key-id imageReference")
+	}
+	imageName := args[0]
+	keyID := strings.ToUpper(strings.TrimPrefix(opts.keyID, "0x"))
+	if len(keyID) != 16 && len(keyID) != 40 {
+		return fmt.Errorf("Invalid key ID %s, expected a 16-digit key ID or a 40-digit fingerprint", opts.keyID)
+	}
+
+	if err := reexecIfNecessaryForImages(imageName); err != nil {
+		return err
+	}
+
+	ref, err := alltransports.ParseImageName(imageName)
+	if err != nil {
+		return fmt.Errorf("Invalid image name %s: %v", imageName, err)
+	}
+	if err := checkSignaturesReplaceable(ref); err != nil {
+		return err
+	}
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	man, sigs, err := getManifestAndSignatures(ctx, sys, ref)
+	if err != nil {
+		return err
+	}
+
+	keptSigs := [][]byte{}
+	for _, sig := range sigs {
+		untrustedInfo, err := signature.GetUntrustedSignatureInformationWithoutVerifying(sig)
+		// A signature which can't be decoded is not known to be made by keyID; keep it.
+		// There is no need to verify the signature: removing a signature which falsely claims to be made by keyID is harmless.
+		if err == nil && untrustedInfo.UntrustedShortKeyIdentifier != "" &&
+			strings.HasSuffix(keyID, strings.ToUpper(untrustedInfo.UntrustedShortKeyIdentifier)) {
+			continue
+		}
+		keptSigs = append(keptSigs, sig)
+	}
+	if len(keptSigs) == len(sigs) {
+		return fmt.Errorf("No signatures made by key %s found in %s", opts.keyID, imageName)
+	}
+
+	if err := replaceSignatures(ctx, sys, ref, man, keptSigs); err != nil {
+		return fmt.Errorf("Error writing signatures: %v", err)
+	}
+	// Some transports can only add signatures; make sure the signatures are really gone.
+	_, newSigs, err := getManifestAndSignatures(ctx, sys, ref)
+	if err != nil {
+		return err
+	}
+	if len(newSigs) != len(keptSigs) {
+		return fmt.Errorf("Signatures could not be removed from %s, the image has %d signatures instead of %d", imageName, len(newSigs), len(keptSigs))
+	}
+	return nil
+}
+
+// getManifestAndSignatures returns the manifest and signatures of the image at ref.
+func getManifestAndSignatures(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (man []byte, sigs [][]byte, retErr error) {
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		}
+	}()
+	man, _, err = src.GetManifest(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading manifest: %v", err)
+	}
+	sigs, err = src.GetSignatures(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading signatures: %v", err)
+	}
+	return man, sigs, nil
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSignedDirImage creates a dir: image in a temporary directory, using fixtures/image.manifest.json
+// and signature files with the specified contents.
+func newSignedDirImage(t *testing.T, signatures ...string) string {
+	dir, err := ioutil.TempDir("", "skopeo-signatures")
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "version"), []byte("Directory Transport Version: 1.1\n"), 0644)
+	require.NoError(t, err)
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "manifest.json"), manifest, 0644)
+	require.NoError(t, err)
+	for i, path := range signatures {
+		sig, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		err = ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("signature-%d", i+1)), sig, 0644)
+		require.NoError(t, err)
+	}
+	return dir
+}
+
+func TestSignaturesList(t *testing.T) {
+	os.Setenv("GNUPGHOME", "fixtures")
+	defer os.Unsetenv("GNUPGHOME")
+
+	// Invalid command-line arguments
+	for _, args := range [][]string{
+		{},
+		{"a1", "a2"},
+	} {
+		out, err := runSkopeo(append([]string{"signatures", "list"}, args...)...)
+		assertTestFailed(t, out, err, "Usage")
+	}
+
+	// Invalid image name
+	out, err := runSkopeo("signatures", "list", "this-is-not-a-transport:foo")
+	assertTestFailed(t, out, err, "Invalid image name")
+
+	dir := newSignedDirImage(t, "fixtures/image.signature", "fixtures/corrupt.signature")
+	defer os.RemoveAll(dir)
+	out, err = runSkopeo("signatures", "list", "dir:"+dir)
+	require.NoError(t, err)
+	var res []map[string]interface{}
+	err = json.Unmarshal([]byte(out), &res)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, float64(0), res[0]["Index"])
+	assert.Equal(t, true, res[0]["Verified"])
+	assert.Equal(t, fixturesTestKeyFingerprint, res[0]["KeyFingerprint"])
+	assert.Equal(t, "testing/manifest", res[0]["UntrustedDockerReference"])
+	assert.Equal(t, fixturesTestImageManifestDigest.String(), res[0]["UntrustedDockerManifestDigest"])
+	assert.Equal(t, fixturesTestKeyShortID, res[0]["UntrustedShortKeyIdentifier"])
+	assert.NotContains(t, res[0], "VerificationError")
+	assert.Equal(t, float64(1), res[1]["Index"])
+	assert.Equal(t, false, res[1]["Verified"])
+	assert.NotContains(t, res[1], "KeyFingerprint")
+	assert.NotEmpty(t, res[1]["VerificationError"])
+
+	// No signatures
+	dir2 := newSignedDirImage(t)
+	defer os.RemoveAll(dir2)
+	out, err = runSkopeo("signatures", "list", "dir:"+dir2)
+	require.NoError(t, err)
+	assert.Equal(t, "[]\n", out)
+}
+
+func TestSignaturesRemove(t *testing.T) {
+	// Invalid command-line arguments
+	for _, args := range [][]string{
+		{},
+		{"a1"},
+		{"--key-id", fixturesTestKeyShortID},
+		{"--key-id", fixturesTestKeyShortID, "a1", "a2"},
+	} {
+		out, err := runSkopeo(append([]string{"signatures", "remove"}, args...)...)
+		assertTestFailed(t, out, err, "Usage")
+	}
+
+	// Invalid key ID
+	out, err := runSkopeo("signatures", "remove", "--key-id", "1234", "dir:/dev/null")
+	assertTestFailed(t, out, err, "Invalid key ID")
+
+	// fixtures/image.manifest.json is not a signature at all, and it is kept.
+	dir := newSignedDirImage(t, "fixtures/image.signature", "fixtures/image.manifest.json", "fixtures/corrupt.signature")
+	defer os.RemoveAll(dir)
+
+	// No matching signature
+	out, err = runSkopeo("signatures", "remove", "--key-id", "0123456789ABCDEF", "dir:"+dir)
+	assertTestFailed(t, out, err, "No signatures made by key")
+
+	// Success, using a lower-case fingerprint
+	out, err = runSkopeo("signatures", "remove", "--key-id", "1d8230f6cdb6a06716e414c1db72f2188bb46cc8", "dir:"+dir)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+	notASignature, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	sig, err := ioutil.ReadFile(filepath.Join(dir, "signature-1"))
+	require.NoError(t, err)
+	assert.Equal(t, notASignature, sig)
+	for _, name := range []string{"signature-2", "signature-3"} {
+		_, err = os.Stat(filepath.Join(dir, name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+
+	// Success, using a key ID
+	dir2 := newSignedDirImage(t, "fixtures/image.signature")
+	defer os.RemoveAll(dir2)
+	out, err = runSkopeo("signatures", "remove", "--key-id", fixturesTestKeyShortID, "dir:"+dir2)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+	_, err = os.Stat(filepath.Join(dir2, "signature-1"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Success, with a docker: image using file:// lookaside storage
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	registry := newTestRegistry(manifest)
+	defer registry.Close()
+	registryHost := strings.TrimPrefix(registry.URL, "http://")
+	sigstore, err := ioutil.TempDir("", "skopeo-signatures-sigstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(sigstore)
+	sigDir := filepath.Join(sigstore, fmt.Sprintf("busybox@%s=%s", fixturesTestImageManifestDigest.Algorithm(), fixturesTestImageManifestDigest.Hex()))
+	err = os.Mkdir(sigDir, 0755)
+	require.NoError(t, err)
+	validSig, err := ioutil.ReadFile("fixtures/image.signature")
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(sigDir, "signature-1"), validSig, 0644)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(sigDir, "signature-2"), notASignature, 0644)
+	require.NoError(t, err)
+	registriesD, err := ioutil.TempDir("", "skopeo-signatures-registries.d")
+	require.NoError(t, err)
+	defer os.RemoveAll(registriesD)
+	err = ioutil.WriteFile(filepath.Join(registriesD, "sigstore.yaml"),
+		[]byte(fmt.Sprintf("docker:\n  %s:\n    sigstore: file://%s\n", registryHost, sigstore)), 0644)
+	require.NoError(t, err)
+	out, err = runSkopeo("--registries.d", registriesD, "signatures", "remove", "--tls-verify=false", "--key-id", fixturesTestKeyShortID,
+		"docker://"+registryHost+"/busybox:latest")
+	require.NoError(t, err)
+	assert.Empty(t, out)
+	sig, err = ioutil.ReadFile(filepath.Join(sigDir, "signature-1"))
+	require.NoError(t, err)
+	assert.Equal(t, notASignature, sig)
+	_, err = os.Stat(filepath.Join(sigDir, "signature-2"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReplaceSignaturesUnsupportedTransports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skopeo-signatures-unsupported")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The images are not accessed at all, so they don't need to exist.
+	for _, image := range []string{
+		"oci:" + filepath.Join(dir, "layout") + ":latest",
+		"docker-archive:" + filepath.Join(dir, "archive.tar"),
+	} {
+		out, err := runSkopeo("sign", "--sign-by", fixturesTestKeyFingerprint, "--identity", "example.com/busybox:latest", image)
+		assertTestFailed(t, out, err, "is not supported")
+		out, err = runSkopeo("signatures", "remove", "--key-id", fixturesTestKeyShortID, image)
+		assertTestFailed(t, out, err, "is not supported")
+	}
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestReplaceSignaturesContainersStorage(t *testing.T) {
+	registry := newFakeRegistry()
+	defer registry.Close()
+	img := registry.addImage(t, "busybox", time.Now(), "linux", "amd64", "contents", "latest")
+	dir, err := ioutil.TempDir("", "skopeo-signatures-storage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Copy the image, with a valid signature and something which is not a signature at all, into containers-storage.
+	sigDir := filepath.Join(dir, "sigstore", fmt.Sprintf("busybox@%s=%s", img.digest.Algorithm(), img.digest.Hex()))
+	err = os.MkdirAll(sigDir, 0755)
+	require.NoError(t, err)
+	validSig, err := ioutil.ReadFile("fixtures/image.signature")
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(sigDir, "signature-1"), validSig, 0644)
+	require.NoError(t, err)
+	notASignature, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(sigDir, "signature-2"), notASignature, 0644)
+	require.NoError(t, err)
+	registriesD := writeRegistriesD(t, map[string]string{
+		"sigstore.yaml": fmt.Sprintf("docker:\n  %s:\n    sigstore: file://%s\n", registry.host(), filepath.Join(dir, "sigstore")),
+	})
+	defer os.RemoveAll(registriesD)
+	image := fmt.Sprintf("containers-storage:[vfs@%s+%s]busybox:latest", filepath.Join(dir, "root"), filepath.Join(dir, "runroot"))
+	out, err := runSkopeo("--insecure-policy", "--registries.d", registriesD, "copy", "--src-tls-verify=false",
+		"docker://"+registry.host()+"/busybox:latest", image)
+	require.NoError(t, err, out)
+
+	out, err = runSkopeo("signatures", "remove", "--key-id", fixturesTestKeyShortID, image)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+	out, err = runSkopeo("signatures", "list", image)
+	require.NoError(t, err)
+	var res []map[string]interface{}
+	err = json.Unmarshal([]byte(out), &res)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, false, res[0]["Verified"])
+	// The rest of the image is unchanged.
+	out, err = runSkopeo("inspect", image)
+	require.NoError(t, err)
+	assert.Contains(t, out, img.digest.String())
+}
+
+// fakeOpenShiftSignature is a subset of an OpenShift ImageSignature object.
+type fakeOpenShiftSignature struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Type    string `json:"type"`
+	Content []byte `json:"content"`
+}
+
+// newFakeOpenShift returns a plain-HTTP server acting as both the OpenShift API server and the registry for a ns/stream:latest
+// image using manifest, with signatures.
+func newFakeOpenShift(manifest []byte, signatures *[]fakeOpenShiftSignature) *httptest.Server {
+	manifestDigest := digest.FromBytes(manifest)
+	mu := sync.Mutex{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.Method == "GET" && r.URL.Path == "/v2/ns/stream/manifests/"+manifestDigest.String():
+			w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+			w.Write(manifest)
+		case r.Method == "GET" && r.URL.Path == "/oapi/v1/namespaces/ns/imagestreams/stream":
+			fmt.Fprintf(w, `{"status":{"tags":[{"tag":"latest","items":[{"dockerImageReference":"172.30.0.1:5000/ns/stream@%s","image":"%s"}]}]}}`,
+				manifestDigest, manifestDigest)
+		case r.Method == "GET" && r.URL.Path == "/oapi/v1/namespaces/ns/imagestreamimages/stream@"+manifestDigest.String():
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"image": map[string]interface{}{
+					"metadata":   map[string]string{"name": manifestDigest.String()},
+					"signatures": *signatures,
+				},
+			})
+		case r.Method == "POST" && r.URL.Path == "/oapi/v1/imagesignatures":
+			var sig fakeOpenShiftSignature
+			if err := json.NewDecoder(r.Body).Decode(&sig); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			*signatures = append(*signatures, sig)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("{}"))
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/oapi/v1/imagesignatures/"):
+			name := strings.TrimPrefix(r.URL.Path, "/oapi/v1/imagesignatures/")
+			for i, sig := range *signatures {
+				if sig.Metadata.Name == name {
+					*signatures = append((*signatures)[:i], (*signatures)[i+1:]...)
+					w.Write([]byte("{}"))
+					return
+				}
+			}
+			http.NotFound(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestReplaceSignaturesAtomic(t *testing.T) {
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+	validSig, err := ioutil.ReadFile("fixtures/image.signature")
+	require.NoError(t, err)
+	newSignature := func(name, sigType string, content []byte) fakeOpenShiftSignature {
+		sig := fakeOpenShiftSignature{Type: sigType, Content: content}
+		sig.Metadata.Name = name
+		return sig
+	}
+	signatures := []fakeOpenShiftSignature{
+		newSignature(fixturesTestImageManifestDigest.String()+"@1", "atomic", validSig),
+		newSignature(fixturesTestImageManifestDigest.String()+"@2", "atomic", manifest), // Not a signature at all, kept
+		newSignature(fixturesTestImageManifestDigest.String()+"@3", "other", validSig),  // Not an atomic signature, kept
+	}
+	server := newFakeOpenShift(manifest, &signatures)
+	defer server.Close()
+	serverHost := strings.TrimPrefix(server.URL, "http://")
+
+	dir, err := ioutil.TempDir("", "skopeo-signatures-atomic")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	kubeConfig := filepath.Join(dir, "config")
+	err = ioutil.WriteFile(kubeConfig, []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+users:
+- name: test
+  user:
+    token: test-token
+current-context: test
+`, server.URL)), 0600)
+	require.NoError(t, err)
+	defer setEnv("KUBECONFIG", kubeConfig)()
+
+	out, err := runSkopeo("signatures", "remove", "--tls-verify=false", "--key-id", fixturesTestKeyShortID, "atomic:"+serverHost+"/ns/stream:latest")
+	require.NoError(t, err)
+	assert.Empty(t, out)
+	require.Len(t, signatures, 2)
+	assert.Equal(t, fixturesTestImageManifestDigest.String()+"@2", signatures[0].Metadata.Name)
+	assert.Equal(t, manifest, signatures[0].Content)
+	assert.Equal(t, fixturesTestImageManifestDigest.String()+"@3", signatures[1].Metadata.Name)
+}
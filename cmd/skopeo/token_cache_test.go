@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBearerTokenCache(t *testing.T) {
+	manifest, err := ioutil.ReadFile("fixtures/image.manifest.json")
+	require.NoError(t, err)
+
+	var tokensIssued int32
+	issuedAt := time.Now()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			n := atomic.AddInt32(&tokensIssued, 1)
+			username, _, _ := r.BasicAuth()
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"token":      fmt.Sprintf("token-%s-%d", username, n),
+				"expires_in": 3600,
+				"issued_at":  issuedAt.UTC().Format(time.RFC3339),
+			})
+		case !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer token-"):
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/v2/busybox/manifests/latest":
+			w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+			w.Write(manifest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	image := "docker://" + strings.TrimPrefix(server.URL, "http://") + "/busybox:latest"
+
+	dir, err := ioutil.TempDir("", "skopeo-token-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "tokens")
+
+	inspect := func(cacheTokens bool, creds string) {
+		args := []string{}
+		if cacheTokens {
+			args = append(args, "--token-cache-dir", cacheDir)
+		}
+		args = append(args, "inspect", "--tls-verify=false", "--raw")
+		if creds != "" {
+			args = append(args, "--creds", creds)
+		}
+		out, err := runSkopeo(append(args, image)...)
+		require.NoError(t, err)
+		assert.Equal(t, string(manifest), out)
+	}
+
+	// Without the cache, each invocation obtains a new token.
+	inspect(false, "")
+	inspect(false, "")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&tokensIssued))
+
+	// With the cache, the token is reused.
+	inspect(true, "")
+	inspect(true, "")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&tokensIssued))
+	fi, err := os.Stat(cacheDir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+	files, err := ioutil.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, files, 2) // The key and a token
+	for _, f := range files {
+		assert.Equal(t, os.FileMode(0600), f.Mode().Perm(), f.Name())
+	}
+
+	// Different credentials use a different token.
+	inspect(true, "user:pass1")
+	inspect(true, "user:pass1")
+	assert.Equal(t, int32(4), atomic.LoadInt32(&tokensIssued))
+	inspect(true, "user:pass2")
+	assert.Equal(t, int32(5), atomic.LoadInt32(&tokensIssued))
+	files, err = ioutil.ReadDir(cacheDir)
+	require.NoError(t, err)
+	assert.Len(t, files, 4)
+	for _, f := range files {
+		contents, err := ioutil.ReadFile(filepath.Join(cacheDir, f.Name()))
+		require.NoError(t, err)
+		assert.NotContains(t, string(contents), "pass")
+	}
+
+	// The names of the token files depend on the key of the cache directory.
+	tokenFiles := func() []string {
+		res := []string{}
+		files, err := ioutil.ReadDir(cacheDir)
+		require.NoError(t, err)
+		for _, f := range files {
+			if f.Name() != "key-v1" {
+				res = append(res, f.Name())
+			}
+		}
+		return res
+	}
+	oldTokenFiles := tokenFiles()
+	err = os.RemoveAll(cacheDir)
+	require.NoError(t, err)
+	inspect(true, "")
+	inspect(true, "user:pass1")
+	assert.Equal(t, int32(7), atomic.LoadInt32(&tokensIssued))
+	for _, name := range tokenFiles() {
+		assert.NotContains(t, oldTokenFiles, name)
+	}
+
+	// A directory accessible by other users is not used, and not modified.
+	err = os.Chmod(cacheDir, 0755)
+	require.NoError(t, err)
+	before := tokenFiles()
+	inspect(true, "")
+	inspect(true, "")
+	assert.Equal(t, int32(9), atomic.LoadInt32(&tokensIssued))
+	assert.Equal(t, before, tokenFiles())
+	err = os.Chmod(cacheDir, 0700)
+	require.NoError(t, err)
+
+	// Expired tokens are not reused.
+	err = os.RemoveAll(cacheDir)
+	require.NoError(t, err)
+	issuedAt = time.Now().Add(-2 * time.Hour)
+	inspect(true, "")
+	inspect(true, "")
+	assert.Equal(t, int32(11), atomic.LoadInt32(&tokensIssued))
+}
@@ -3,11 +3,17 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"strings"
 
+	"github.com/containers/image/docker"
+	"github.com/containers/image/docker/reference"
+	"github.com/containers/image/pkg/shortnames"
+	"github.com/containers/image/pkg/sysregistriesv2"
 	"github.com/containers/image/transports/alltransports"
 	"github.com/containers/image/types"
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
 
@@ -60,6 +66,7 @@ type imageOptions struct {
 	sharedBlobDir    string              // A directory to use for OCI blobs, shared across repositories
 	dockerDaemonHost string              // docker-daemon: host to connect to
 	noCreds          bool                // Access the registry anonymously
+	registryToken    string              // A pre-obtained bearer token for accessing the registry
 }
 
 // imageFlags prepares a collection of CLI flags writing into imageOptions, and the managed imageOptions structure.
@@ -107,6 +114,11 @@ func imageFlags(global *globalOptions, shared *sharedImageOptions, flagPrefix, c
 			Usage:       "Access the registry anonymously",
 			Destination: &opts.noCreds,
 		},
+		cli.StringFlag{
+			Name:        flagPrefix + "registry-token",
+			Usage:       "Provide a Bearer `TOKEN` for accessing the registry",
+			Destination: &opts.registryToken,
+		},
 	}, &opts
 }
 
@@ -114,15 +126,16 @@ func imageFlags(global *globalOptions, shared *sharedImageOptions, flagPrefix, c
 // It is guaranteed to return a fresh instance, so it is safe to make additional updates to it.
 func (opts *imageOptions) newSystemContext() (*types.SystemContext, error) {
 	ctx := &types.SystemContext{
-		RegistriesDirPath:        opts.global.registriesDirPath,
-		ArchitectureChoice:       opts.global.overrideArch,
-		OSChoice:                 opts.global.overrideOS,
-		DockerCertPath:           opts.dockerCertPath,
-		OCISharedBlobDirPath:     opts.sharedBlobDir,
-		AuthFilePath:             opts.shared.authFilePath,
-		DockerDaemonHost:         opts.dockerDaemonHost,
-		DockerDaemonCertPath:     opts.dockerCertPath,
-		SystemRegistriesConfPath: opts.global.registriesConfPath,
+		RegistriesDirPath:         opts.global.registriesDirPath,
+		ArchitectureChoice:        opts.global.overrideArch,
+		OSChoice:                  opts.global.overrideOS,
+		DockerCertPath:            opts.dockerCertPath,
+		OCISharedBlobDirPath:      opts.sharedBlobDir,
+		AuthFilePath:              opts.shared.authFilePath,
+		DockerDaemonHost:          opts.dockerDaemonHost,
+		DockerDaemonCertPath:      opts.dockerCertPath,
+		SystemRegistriesConfPath:  opts.global.registriesConfPath,
+		DockerBearerTokenCacheDir: opts.global.tokenCacheDir,
 	}
 	if opts.tlsVerify.present {
 		ctx.DockerDaemonInsecureSkipTLSVerify = !opts.tlsVerify.value
@@ -147,6 +160,12 @@ func (opts *imageOptions) newSystemContext() (*types.SystemContext, error) {
 	if opts.noCreds {
 		ctx.DockerAuthConfig = &types.DockerAuthConfig{}
 	}
+	if opts.registryToken != "" {
+		if opts.credsOption.present || opts.noCreds {
+			return nil, errors.New("registry-token can not be specified together with creds or no-creds")
+		}
+		ctx.DockerBearerRegistryToken = opts.registryToken
+	}
 	return ctx, nil
 }
 
@@ -217,11 +236,11 @@ func getDockerAuth(creds string) (*types.DockerAuthConfig, error) {
 // parseImage converts image URL-like string to an initialized handler for that image.
 // The caller must call .Close() on the returned ImageCloser.
 func parseImage(ctx context.Context, opts *imageOptions, name string) (types.ImageCloser, error) {
-	ref, err := alltransports.ParseImageName(name)
+	sys, err := opts.newSystemContext()
 	if err != nil {
 		return nil, err
 	}
-	sys, err := opts.newSystemContext()
+	ref, err := parseSourceImageName(ctx, sys, name)
 	if err != nil {
 		return nil, err
 	}
@@ -231,13 +250,64 @@ func parseImage(ctx context.Context, opts *imageOptions, name string) (types.Ima
 // parseImageSource converts image URL-like string to an ImageSource.
 // The caller must call .Close() on the returned ImageSource.
 func parseImageSource(ctx context.Context, opts *imageOptions, name string) (types.ImageSource, error) {
-	ref, err := alltransports.ParseImageName(name)
+	sys, err := opts.newSystemContext()
 	if err != nil {
 		return nil, err
 	}
-	sys, err := opts.newSystemContext()
+	ref, err := parseSourceImageName(ctx, sys, name)
 	if err != nil {
 		return nil, err
 	}
 	return ref.NewImageSource(ctx, sys)
 }
+
+// parseSourceImageName converts image URL-like string, naming an image to read from, to an ImageReference.
+// Unlike alltransports.ParseImageName, it resolves short names in the docker: transport (e.g. docker://busybox)
+// using aliases and unqualified-search registries, if enabled in registries.conf.
+func parseSourceImageName(ctx context.Context, sys *types.SystemContext, name string) (types.ImageReference, error) {
+	ref, err := alltransports.ParseImageName(name)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Transport() != docker.Transport {
+		return ref, nil
+	}
+	shortName := strings.TrimPrefix(strings.TrimPrefix(name, docker.Transport.Name()+":"), "//")
+	if !sysregistriesv2.IsShortName(shortName) {
+		return ref, nil
+	}
+	mode, err := sysregistriesv2.ShortNameMode(sys)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading registries configuration: %v", err)
+	}
+	if mode == sysregistriesv2.ShortNameModeDisabled {
+		return ref, nil
+	}
+
+	candidates, err := shortnames.Resolve(sys, shortName)
+	if err != nil {
+		return nil, err
+	}
+	var candidateErrors []string
+	for _, candidate := range candidates {
+		candidateRef, err := docker.NewReference(reference.TagNameOnly(candidate.Value))
+		if err != nil {
+			return nil, err
+		}
+		if len(candidates) > 1 {
+			// Use the first candidate which exists.
+			src, err := candidateRef.NewImageSource(ctx, sys)
+			if err != nil {
+				logrus.Debugf("Short name %q does not refer to %q: %v", shortName, candidate.Value.String(), err)
+				candidateErrors = append(candidateErrors, fmt.Sprintf("%s: %v", candidate.Value.String(), err))
+				continue
+			}
+			if err := src.Close(); err != nil {
+				return nil, err
+			}
+		}
+		logrus.Infof("Resolved short name %q to %q (%s)", shortName, candidate.Value.String(), candidate.Origin)
+		return candidateRef, nil
+	}
+	return nil, fmt.Errorf("Error resolving short name %q, no unqualified-search registry contains the image: %s", shortName, strings.Join(candidateErrors, "; "))
+}
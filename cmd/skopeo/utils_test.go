@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"io/ioutil"
+	"os"
 	"testing"
 
+	"github.com/containers/image/pkg/shortnames"
+	"github.com/containers/image/transports"
 	"github.com/containers/image/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -182,3 +187,101 @@ func TestImageDestOptionsNewSystemContext(t *testing.T) {
 	_, err = opts.newSystemContext()
 	assert.Error(t, err)
 }
+
+func TestParseSourceImageName(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "skopeo-short-names")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	// Access to the *.invalid registries is blocked, so that trying to use them fails without network access.
+	const commonConf = `
+[aliases]
+"myapp" = "blocked.invalid/team/myapp"
+"team/other" = "blocked.invalid/other"
+
+[[registry]]
+location = "blocked.invalid"
+blocked = true
+
+[[registry]]
+location = "a.invalid"
+blocked = true
+
+[[registry]]
+location = "b.invalid"
+blocked = true
+`
+	newSys := func(conf string) *types.SystemContext {
+		// The configuration is cached by path, so use a new file every time.
+		f, err := ioutil.TempFile(tmpDir, "registries.conf")
+		require.NoError(t, err)
+		_, err = f.WriteString(conf)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		return &types.SystemContext{SystemRegistriesConfPath: f.Name()}
+	}
+	ctx := context.Background()
+
+	disabled := newSys(`unqualified-search-registries = ["a.invalid", "b.invalid"]` + commonConf)
+	permissive := newSys(`unqualified-search-registries = ["a.invalid", "b.invalid"]
+short-name-mode = "permissive"` + commonConf)
+	enforcing := newSys(`unqualified-search-registries = ["a.invalid", "b.invalid"]
+short-name-mode = "enforcing"` + commonConf)
+	enforcingSingle := newSys(`unqualified-search-registries = ["a.invalid"]
+short-name-mode = "enforcing"` + commonConf)
+	enforcingNone := newSys(`short-name-mode = "enforcing"` + commonConf)
+
+	for _, c := range []struct {
+		sys      *types.SystemContext
+		input    string
+		expected string // "" if an error is expected
+	}{
+		// Not affected by short name resolution
+		{enforcing, "dir:/dev/null", "dir:/dev/null"},
+		{enforcing, "docker://example.com/busybox", "docker://example.com/busybox:latest"},
+		{enforcing, "docker://localhost/busybox:1", "docker://localhost/busybox:1"},
+		{disabled, "docker://busybox", "docker://busybox:latest"},
+		{disabled, "docker://myapp", "docker://myapp:latest"},
+		// Aliases
+		{permissive, "docker://myapp", "docker://blocked.invalid/team/myapp:latest"},
+		{enforcing, "docker://myapp:1.0", "docker://blocked.invalid/team/myapp:1.0"},
+		{enforcing, "docker://myapp@sha256:20bf21ed457b390829cdbeec8795a7bea1626991fda603e0d01b4e7f60427e55",
+			"docker://blocked.invalid/team/myapp@sha256:20bf21ed457b390829cdbeec8795a7bea1626991fda603e0d01b4e7f60427e55"},
+		{enforcingNone, "docker://team/other:2", "docker://blocked.invalid/other:2"},
+		// A single unqualified-search registry is used without checking that the image exists
+		{enforcingSingle, "docker://busybox", "docker://a.invalid/busybox:latest"},
+		{enforcingSingle, "docker://team/busybox:1", "docker://a.invalid/team/busybox:1"},
+		// Ambiguous, or impossible to resolve
+		{enforcing, "docker://busybox", ""},
+		{enforcingNone, "docker://busybox", ""},
+		{permissive, "docker://busybox", ""}, // All candidates are blocked
+		// Invalid syntax
+		{enforcing, "docker://busybox:1@sha256:20bf21ed457b390829cdbeec8795a7bea1626991fda603e0d01b4e7f60427e55", ""},
+	} {
+		ref, err := parseSourceImageName(ctx, c.sys, c.input)
+		if c.expected == "" {
+			assert.Error(t, err, c.input)
+		} else {
+			require.NoError(t, err, c.input)
+			assert.Equal(t, c.expected, transports.ImageName(ref), c.input)
+		}
+	}
+
+	_, err = parseSourceImageName(ctx, enforcing, "docker://busybox")
+	assert.IsType(t, shortnames.AmbiguousShortNameError{}, err)
+	_, err = parseSourceImageName(ctx, permissive, "docker://busybox")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "a.invalid/busybox")
+	assert.Contains(t, err.Error(), "b.invalid/busybox")
+
+	// Invalid configuration
+	for _, conf := range []string{
+		`short-name-mode = "unknown"`,
+		"[aliases]\n\"example.com/myapp\" = \"example.com/myapp\"",
+		"[aliases]\n\"myapp:1\" = \"example.com/myapp\"",
+		"[aliases]\n\"myapp\" = \"myapp\"",
+		"[aliases]\n\"myapp\" = \"example.com/myapp:1\"",
+	} {
+		_, err := parseSourceImageName(ctx, newSys(conf), "docker://myapp")
+		assert.Error(t, err, conf)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/containers/image/image"
+	"github.com/containers/image/pkg/blobinfocache"
+	"github.com/containers/image/pkg/compression"
+	"github.com/containers/image/signature"
+	"github.com/containers/image/transports"
+	"github.com/containers/image/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+type verifyOptions struct {
+	global *globalOptions
+	image  *imageOptions
+}
+
+func verifyCmd(global *globalOptions) cli.Command {
+	sharedFlags, sharedOpts := sharedImageFlags()
+	imageFlags, imageOpts := imageFlags(global, sharedOpts, "", "")
+	opts := verifyOptions{
+		global: global,
+		image:  imageOpts,
+	}
+	return cli.Command{
+		Name:  "verify",
+		Usage: "Verify the integrity of IMAGE-NAME",
+		Description: fmt.Sprintf(`
+	Read the manifest, configuration and all layers of "IMAGE-NAME", verify the digests and sizes of all blobs,
+	verify the uncompressed layers against the diffIDs in the configuration, and evaluate the signature verification policy
+
+	All problems found are written to standard output; the command fails if there are any
+
+	Supported transports:
+	%s
+
+	See skopeo(1) section "IMAGE NAMES" for the expected format
+	`, strings.Join(transports.ListNames(), ", ")),
+		ArgsUsage: "IMAGE-NAME",
+		Action:    commandAction(opts.run),
+		Flags:     append(sharedFlags, imageFlags...),
+	}
+}
+
+func (opts *verifyOptions) run(args []string, stdout io.Writer) (retErr error) {
+	if len(args) != 1 {
+		return errors.New("Usage: skopeo verify IMAGE-NAME")
+	}
+	imageName := args[0]
+
+	if err := reexecIfNecessaryForImages(imageName); err != nil {
+		return err
+	}
+
+	policyContext, err := opts.global.getPolicyContext()
+	if err != nil {
+		return fmt.Errorf("Error loading trust policy: %v", err)
+	}
+	defer policyContext.Destroy()
+
+	ctx, cancel := opts.global.commandTimeoutContext()
+	defer cancel()
+
+	sys, err := opts.image.newSystemContext()
+	if err != nil {
+		return err
+	}
+	src, err := parseImageSource(ctx, opts.image, imageName)
+	if err != nil {
+		return fmt.Errorf("Error parsing image name %q: %v", imageName, err)
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			retErr = errors.Wrapf(retErr, " (close error: %v)", err)
+		}
+	}()
+
+	v := imageVerifier{
+		ctx:           ctx,
+		sys:           sys,
+		src:           src,
+		policyContext: policyContext,
+		cache:         blobinfocache.DefaultCache(sys),
+		stdout:        stdout,
+	}
+	unparsed := image.UnparsedInstance(src, nil)
+	man, mimeType, err := unparsed.Manifest(ctx)
+	if err != nil {
+		return fmt.Errorf("Error reading manifest: %v", err)
+	}
+	if isManifestList(mimeType) {
+		v.checkPolicy(unparsed, "")
+		instances, err := parseManifestList(man, mimeType)
+		if err != nil {
+			return err
+		}
+		for _, instance := range instances {
+			instanceDigest := instance.Digest
+			v.verifyImage(image.UnparsedInstance(src, &instanceDigest), fmt.Sprintf("Image %s: ", instanceDigest))
+		}
+	} else {
+		v.verifyImage(unparsed, "")
+	}
+
+	if v.problems != 0 {
+		return fmt.Errorf("%d problem(s) found in %s", v.problems, imageName)
+	}
+	fmt.Fprintf(stdout, "No problems found in %s\n", imageName)
+	return nil
+}
+
+// imageVerifier verifies images for (skopeo verify), and reports the problems it finds.
+type imageVerifier struct {
+	ctx           context.Context
+	sys           *types.SystemContext
+	src           types.ImageSource
+	policyContext *signature.PolicyContext
+	cache         types.BlobInfoCache
+	stdout        io.Writer
+	problems      int // The number of problems reported so far
+}
+
+// reportf reports a problem.
+func (v *imageVerifier) reportf(format string, args ...interface{}) {
+	v.problems++
+	fmt.Fprintf(v.stdout, format+"\n", args...)
+}
+
+// checkPolicy reports a problem if the policy rejects unparsed; prefix identifies the image in the report.
+func (v *imageVerifier) checkPolicy(unparsed types.UnparsedImage, prefix string) {
+	allowed, err := v.policyContext.IsRunningImageAllowed(v.ctx, unparsed)
+	if err != nil {
+		v.reportf("%sRejected by policy: %v", prefix, err)
+	} else if !allowed {
+		v.reportf("%sRejected by policy", prefix)
+	}
+}
+
+// verifyImage verifies the single image unparsed; prefix identifies the image in the report.
+func (v *imageVerifier) verifyImage(unparsed *image.UnparsedImage, prefix string) {
+	v.checkPolicy(unparsed, prefix)
+	img, err := image.FromUnparsedImage(v.ctx, v.sys, unparsed)
+	if err != nil {
+		v.reportf("%sError reading manifest: %v", prefix, err)
+		return
+	}
+
+	var diffIDs []digest.Digest
+	layers := img.LayerInfos()
+	if configInfo := img.ConfigInfo(); configInfo.Digest != "" {
+		if _, ok := v.verifyBlob(prefix+"Config", configInfo, false); ok {
+			config, err := img.OCIConfig(v.ctx)
+			if err != nil {
+				v.reportf("%sError parsing configuration: %v", prefix, err)
+			} else if len(config.RootFS.DiffIDs) != len(layers) {
+				v.reportf("%sThe image contains %d layers, but the configuration lists %d diffIDs", prefix, len(layers), len(config.RootFS.DiffIDs))
+			} else {
+				diffIDs = config.RootFS.DiffIDs
+			}
+		}
+	}
+	for i, layer := range layers {
+		diffID, _ := v.verifyBlob(prefix+"Layer", layer, true)
+		if diffID != "" && diffIDs != nil && diffID != diffIDs[i] {
+			v.reportf("%sLayer %s: diffID is %s, but the configuration expects %s", prefix, layer.Digest, diffID, diffIDs[i])
+		}
+	}
+}
+
+// verifyBlob reads the blob described by info, and reports any problems with its digest or size; kind identifies the blob in the report.
+// It returns true if the blob is valid, and if uncompressed, also the digest of its uncompressed contents, or "" if they could not be read.
+func (v *imageVerifier) verifyBlob(kind string, info types.BlobInfo, uncompressed bool) (digest.Digest, bool) {
+	if err := info.Digest.Validate(); err != nil {
+		v.reportf("%s %s: Invalid digest: %v", kind, info.Digest, err)
+		return "", false
+	}
+	stream, _, err := v.src.GetBlob(v.ctx, info, v.cache)
+	if err != nil {
+		v.reportf("%s %s: Error reading blob: %v", kind, info.Digest, err)
+		return "", false
+	}
+	defer stream.Close()
+
+	digester := info.Digest.Algorithm().Digester()
+	counter := &byteCounter{}
+	reader := io.TeeReader(stream, io.MultiWriter(digester.Hash(), counter))
+	var diffID digest.Digest
+	if uncompressed {
+		diffID, err = uncompressedDigest(reader)
+		if err != nil {
+			v.reportf("%s %s: Error decompressing blob: %v", kind, info.Digest, err)
+		}
+	}
+	// Read the rest of the blob, e.g. after a decompression error.
+	if _, err := io.Copy(ioutil.Discard, reader); err != nil {
+		v.reportf("%s %s: Error reading blob: %v", kind, info.Digest, err)
+		return "", false
+	}
+
+	ok := true
+	if actual := digester.Digest(); actual != info.Digest {
+		v.reportf("%s %s: Digest of the contents is %s", kind, info.Digest, actual)
+		ok = false
+	}
+	if info.Size != -1 && counter.size != info.Size {
+		v.reportf("%s %s: Size is %d, expected %d", kind, info.Digest, counter.size, info.Size)
+		ok = false
+	}
+	return diffID, ok
+}
+
+// uncompressedDigest returns the digest of the uncompressed contents of stream.
+func uncompressedDigest(stream io.Reader) (digest.Digest, error) {
+	decompressed, _, err := compression.AutoDecompress(stream)
+	if err != nil {
+		return "", err
+	}
+	defer decompressed.Close()
+	digester := digest.Canonical.Digester()
+	if _, err := io.Copy(digester.Hash(), decompressed); err != nil {
+		return "", err
+	}
+	return digester.Digest(), nil
+}
+
+// byteCounter is an io.Writer which only counts the bytes written to it.
+type byteCounter struct {
+	size int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.size += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containers/image/manifest"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	registry := newFakeRegistry()
+	defer registry.Close()
+	now := time.Now()
+	amd64 := registry.addImage(t, "app", now, "linux", "amd64", "amd64", "amd64")
+	arm64 := registry.addImage(t, "app", now, "linux", "arm64", "arm64", "arm64")
+	registry.addList(t, "app", manifest.DockerV2ListMediaType, []fakeImage{amd64, arm64}, []string{"linux/amd64", "linux/arm64/v8"}, "list")
+	repo := "docker://" + registry.host() + "/app"
+
+	// Valid images
+	for _, image := range []string{repo + ":amd64", repo + ":list"} {
+		out, err := runSkopeo("--insecure-policy", "verify", "--tls-verify=false", image)
+		require.NoError(t, err, image)
+		assert.Equal(t, "No problems found in "+image+"\n", out)
+	}
+
+	// Corrupted blobs in a dir: export
+	tmpDir, err := ioutil.TempDir("", "skopeo-verify")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	dir := filepath.Join(tmpDir, "dir")
+	_, err = runSkopeo("--insecure-policy", "copy", "--src-tls-verify=false", repo+":amd64", "dir:"+dir)
+	require.NoError(t, err)
+	out, err := runSkopeo("--insecure-policy", "verify", "dir:"+dir)
+	require.NoError(t, err)
+	assert.Equal(t, "No problems found in dir:"+dir+"\n", out)
+	err = ioutil.WriteFile(filepath.Join(dir, amd64.layer.Hex()), arm64.layerBlob, 0644)
+	require.NoError(t, err)
+	err = os.Remove(filepath.Join(dir, amd64.config.Hex()))
+	require.NoError(t, err)
+	out, err = runSkopeo("--insecure-policy", "verify", "dir:"+dir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "problem(s) found in dir:"+dir)
+	assert.Contains(t, out, "Config "+amd64.config.String()+": Error reading blob")
+	assert.Contains(t, out, "Layer "+amd64.layer.String()+": Digest of the contents is "+arm64.layer.String())
+
+	// Layers which do not match the diffIDs in the configuration
+	otherDiffID := digest.FromString("other")
+	registry.addImageWithLayers(t, "app", map[string]interface{}{"os": "linux", "architecture": "amd64"},
+		[]digest.Digest{amd64.layer, arm64.layer}, []digest.Digest{amd64.diffID, otherDiffID}, "bad-diffid")
+	registry.addImageWithLayers(t, "app", map[string]interface{}{"os": "linux", "architecture": "amd64"},
+		[]digest.Digest{amd64.layer}, []digest.Digest{amd64.diffID, otherDiffID}, "bad-count")
+	out, err = runSkopeo("--insecure-policy", "verify", "--tls-verify=false", repo+":bad-diffid")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 problem(s) found")
+	assert.Equal(t, "Layer "+arm64.layer.String()+": diffID is "+arm64.diffID.String()+", but the configuration expects "+otherDiffID.String()+"\n", out)
+	out, err = runSkopeo("--insecure-policy", "verify", "--tls-verify=false", repo+":bad-count")
+	require.Error(t, err)
+	assert.Equal(t, "The image contains 1 layers, but the configuration lists 2 diffIDs\n", out)
+
+	// Corrupted blobs in a manifest list
+	registry.mu.Lock()
+	registry.blobs[arm64.layer] = amd64.layerBlob
+	registry.mu.Unlock()
+	out, err = runSkopeo("--insecure-policy", "verify", "--tls-verify=false", repo+":list")
+	require.Error(t, err)
+	assert.Contains(t, out, "Image "+arm64.digest.String()+": Layer "+arm64.layer.String()+": Digest of the contents is "+amd64.layer.String())
+	assert.Contains(t, out, "Image "+arm64.digest.String()+": Layer "+arm64.layer.String()+": diffID is "+amd64.diffID.String())
+	assert.NotContains(t, out, "Image "+amd64.digest.String())
+
+	// Policy
+	policy := filepath.Join(tmpDir, "policy.json")
+	err = ioutil.WriteFile(policy, []byte(`{"default":[{"type":"reject"}]}`), 0644)
+	require.NoError(t, err)
+	out, err = runSkopeo("--policy", policy, "verify", "--tls-verify=false", repo+":amd64")
+	require.Error(t, err)
+	assert.Contains(t, out, "Rejected by policy")
+
+	// Invalid arguments
+	out, err = runSkopeo("--insecure-policy", "verify")
+	assertTestFailed(t, out, err, "Usage")
+	out, err = runSkopeo("--insecure-policy", "verify", "--tls-verify=false", repo+":missing")
+	assertTestFailed(t, out, err, "Error reading manifest")
+}
@@ -504,6 +504,61 @@ func (s *CopySuite) TestCopyDockerSigstore(c *check.C) {
 	assertSkopeoSucceeds(c, "", "--tls-verify=false", "--policy", policy, "--registries.d", registriesDir, "copy", ourRegistry+"public/busybox", dirDest)
 }
 
+// --all --sign-by signs the manifest list, and --sign-all-instances the per-platform images as well.
+func (s *CopySuite) TestCopyManifestListSignatures(c *check.C) {
+	mech, _, err := signature.NewEphemeralGPGSigningMechanism([]byte{})
+	c.Assert(err, check.IsNil)
+	defer mech.Close()
+	if err := mech.SupportsSigning(); err != nil { // FIXME? Test that verification and policy enforcement works, using signatures from fixtures
+		c.Skip(fmt.Sprintf("Signing not supported: %v", err))
+	}
+
+	const ourRegistry = "docker://" + v2DockerRegistryURL + "/"
+
+	tmpDir, err := ioutil.TempDir("", "signatures-manifest-list")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(tmpDir)
+	copyDest := filepath.Join(tmpDir, "dest")
+	err = os.Mkdir(copyDest, 0755)
+	c.Assert(err, check.IsNil)
+	dirDest := "dir:" + copyDest
+	plainSigstore := filepath.Join(tmpDir, "sigstore")
+
+	policy := fileFromFixture(c, "fixtures/policy.json", map[string]string{"@keydir@": s.gpgHome})
+	defer os.Remove(policy)
+	registriesDir := filepath.Join(tmpDir, "registries.d")
+	err = os.Mkdir(registriesDir, 0755)
+	c.Assert(err, check.IsNil)
+	registriesFile := fileFromFixture(c, "fixtures/registries.yaml",
+		map[string]string{"@sigstore@": plainSigstore, "@split-staging@": plainSigstore, "@split-read@": "file://" + plainSigstore})
+	err = os.Symlink(registriesFile, filepath.Join(registriesDir, "registries.yaml"))
+	c.Assert(err, check.IsNil)
+
+	// --sign-all-instances requires --all and --sign-by.
+	assertSkopeoFails(c, ".*--sign-all-instances can only be used together with --all and --sign-by.*",
+		"--tls-verify=false", "--registries.d", registriesDir, "copy", "--sign-all-instances", "docker://estesp/busybox:latest", ourRegistry+"signed/busybox-list")
+
+	out := combinedOutputOfCommand(c, skopeoBinary, "inspect", "--raw", "docker://estesp/busybox:latest")
+	list, err := manifest.Schema2ListFromManifest([]byte(out))
+	c.Assert(err, check.IsNil)
+	c.Assert(list.Manifests, check.Not(check.HasLen), 0)
+
+	// Signing only the list creates a single signature,
+	assertSkopeoSucceeds(c, "", "--tls-verify=false", "--registries.d", registriesDir, "copy", "--all", "--sign-by", "personal@example.com", "docker://estesp/busybox:latest", ourRegistry+"signed/busybox-list")
+	foundFiles := findRegularFiles(c, plainSigstore)
+	c.Assert(foundFiles, check.HasLen, 1)
+	// and pulling an image from the list fails because the chosen image is not signed.
+	assertSkopeoFails(c, ".*Source image rejected: A signature was required, but no signature exists.*",
+		"--tls-verify=false", "--policy", policy, "--registries.d", registriesDir, "copy", ourRegistry+"signed/busybox-list", dirDest)
+
+	// Signing all instances creates a signature for the list and for each image,
+	assertSkopeoSucceeds(c, "", "--tls-verify=false", "--registries.d", registriesDir, "copy", "--all", "--sign-by", "personal@example.com", "--sign-all-instances", "docker://estesp/busybox:latest", ourRegistry+"signed/busybox-list")
+	foundFiles = findRegularFiles(c, plainSigstore)
+	c.Assert(foundFiles, check.HasLen, 1+len(list.Manifests))
+	// and pulling an image from the list, verifying both the list and the image, succeeds.
+	assertSkopeoSucceeds(c, "", "--tls-verify=false", "--policy", policy, "--registries.d", registriesDir, "copy", ourRegistry+"signed/busybox-list", dirDest)
+}
+
 // atomic: and docker: X-Registry-Supports-Signatures works and interoperates
 func (s *CopySuite) TestCopyAtomicExtension(c *check.C) {
 	mech, _, err := signature.NewEphemeralGPGSigningMechanism([]byte{})
@@ -697,6 +752,65 @@ func (s *SkopeoSuite) TestFailureCopySrcWithMirrorAndPrefixUnavailable(c *check.
 		"docker://gcr.invalid/wrong/prefix/busybox", "dir:"+dir)
 }
 
+func (s *CopySuite) TestCopyPushMirrors(c *check.C) {
+	const ourRegistry = "docker://" + v2DockerRegistryURL + "/"
+
+	tmpDir, err := ioutil.TempDir("", "copy-push-mirrors")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(tmpDir)
+	regConf := filepath.Join(tmpDir, "registries.conf")
+	err = ioutil.WriteFile(regConf, []byte(`
+[[registry]]
+location = "`+v2DockerRegistryURL+`/push-primary"
+insecure = true
+
+[[registry.push-mirror]]
+location = "`+v2DockerRegistryURL+`/push-mirror"
+insecure = true
+
+[[registry]]
+location = "`+v2DockerRegistryURL+`/push-redirected"
+insecure = true
+push-to-mirrors-only = true
+
+[[registry.push-mirror]]
+location = "`+v2DockerRegistryURL+`/push-redirect-target"
+insecure = true
+`), 0644)
+	c.Assert(err, check.IsNil)
+
+	// Pushing to a registry with a push mirror writes to both.
+	assertSkopeoSucceeds(c, "", "--registries-conf", regConf, "copy", "--dest-tls-verify=false",
+		"docker://busybox", ourRegistry+"push-primary/busybox:latest")
+	assertSkopeoSucceeds(c, "", "--registries-conf", regConf, "inspect", "--tls-verify=false", ourRegistry+"push-primary/busybox:latest")
+	assertSkopeoSucceeds(c, "", "--registries-conf", regConf, "inspect", "--tls-verify=false", ourRegistry+"push-mirror/busybox:latest")
+
+	// With push-to-mirrors-only, only the mirror is written to.
+	assertSkopeoSucceeds(c, "", "--registries-conf", regConf, "copy", "--dest-tls-verify=false",
+		"docker://busybox", ourRegistry+"push-redirected/busybox:latest")
+	assertSkopeoSucceeds(c, "", "--registries-conf", regConf, "inspect", "--tls-verify=false", ourRegistry+"push-redirect-target/busybox:latest")
+	assertSkopeoFails(c, ".*manifest unknown.*", "--registries-conf", regConf, "inspect", "--tls-verify=false", ourRegistry+"push-redirected/busybox:latest")
+}
+
+func (s *SkopeoSuite) TestFailureCopySrcBlocked(c *check.C) {
+	dir, err := ioutil.TempDir("", "copy-blocked")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+
+	assertSkopeoFails(c, ".*blocked in registries.conf.*", "--registries-conf="+regConfFixture, "copy",
+		"docker://blocked.invalid/busybox", "dir:"+dir)
+	assertSkopeoFails(c, ".*blocked in registries.conf.*", "--registries-conf="+regConfFixture, "copy",
+		"docker://partially-blocked.invalid/blocked/busybox", "dir:"+dir)
+	// Only the prefix is blocked, the rest of the registry is accessible (but does not exist).
+	assertSkopeoFails(c, ".*no such host.*", "--registries-conf="+regConfFixture, "copy",
+		"docker://partially-blocked.invalid/blocked-not/busybox", "dir:"+dir)
+}
+
+func (s *SkopeoSuite) TestFailureCopyDestBlocked(c *check.C) {
+	assertSkopeoFails(c, ".*blocked in registries.conf.*", "--registries-conf="+regConfFixture, "copy",
+		"docker://busybox", "docker://blocked.invalid/busybox")
+}
+
 func (s *CopySuite) TestCopyFailsWhenReferenceIsInvalid(c *check.C) {
 	assertSkopeoFails(c, `.*Invalid image name.*`, "copy", "unknown:transport", "unknown:test")
 }